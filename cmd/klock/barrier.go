@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/spf13/pflag"
+)
+
+const barrierUsage = `klock barrier -- wait for the participants within Kubernetes
+
+# Usage
+
+  klock barrier --name NAME --parties N [flags]
+
+Block until N participants have arrived at the barrier NAME, then exit with 0.
+
+Each participant registers itself by a lease labelled with %s=NAME,
+and renews it every --retry-period while waiting; the expired leases are not counted.
+Use a distinct identity for each participant, e.g. -g.
+The participants are released once N leases exist, or any participant has been released.
+Once released, the later participants arrive at the next generation of the barrier NAME
+and wait for N participants again, even if the leases of the earlier ones remain.
+
+# Examples
+
+  klock barrier --name phase1 --parties 3 -g --cleanup-lease --timeout 10m
+
+# Permissions
+
+The execution of klock barrier requires the following rule:
+
+  - apiGroups: ["coordination.k8s.io"]
+    resources: ["leases"]
+    verbs: ["create", "get", "list", "update"]
+
+If you use --cleanup-lease, please add delete to the verbs.
+
+# Exit status
+
+%d if failure.
+--timeout-exit-code if the participants do not arrive within --timeout.
+
+# Flags
+
+`
+
+func runBarrier(args []string) {
+	fs := newFlagSet("barrier")
+	fs.Usage = func() {
+		fmt.Printf(barrierUsage, lease.LabelBarrier, exitCodeFailure)
+		fs.PrintDefaults()
+	}
+	var (
+		kube             = addKubeFlags(fs)
+		name             = fs.String("name", "", "The name of the barrier.")
+		parties          = fs.Int("parties", 0, "The number of the participants to wait for.")
+		ident            = addIdentityFlags(fs, "participant")
+		cleanupLease     = fs.Bool("cleanup-lease", false, "If true, delete the lease of the participant after all the participants have passed.")
+		timeout          = fs.Duration("timeout", 0, "Fail if the participants do not arrive within the duration. 0 means wait infinitely.")
+		timeoutExitCode  = fs.Uint8("timeout-exit-code", exitCodeFailure, "The exit status used when --timeout is reached.")
+		retryPeriod      = fs.Duration("retry-period", lease.DefaultRetryPeriod, "The time interval between each check of the arrivals.")
+		leaseDuration    = fs.Duration("lease-duration", lease.DefaultLeaseDuration, "The duration of the lease of the participant; it should be greater than --retry-period.")
+		additionalLabels = addLabelsFlag(fs)
+	)
+	err := fs.Parse(args)
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(newContext(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to parse flags", err))
+	}
+	if fs.NArg() > 1 {
+		fail(ctx, fmt.Errorf("%w: %v", errUnexpectedArgs, fs.Args()[1:]))
+	}
+	identity, err := ident.identity()
+	if err != nil {
+		fail(ctx, err)
+	}
+	warnDefaultIdentity(ctx, identity)
+
+	client, err := kube.newClient(ctx)
+	if err != nil {
+		fail(ctx, err)
+	}
+	barrier, err := lease.NewBarrier(
+		*kube.namespace, *name, identity, *parties, client.CoordinationV1(),
+		lease.WithBarrierLabels(*additionalLabels),
+		lease.WithBarrierCleanupLease(*cleanupLease),
+		lease.WithBarrierRetryPeriod(*retryPeriod),
+		lease.WithBarrierLeaseDuration(*leaseDuration),
+		lease.WithBarrierTimeout(*timeout),
+	)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to create barrier", err))
+	}
+	err = barrier.Wait(ctx)
+	stop()
+	if err != nil {
+		if errors.Is(err, lease.ErrBarrierTimedOut) {
+			failWith(ctx, int(*timeoutExitCode), err)
+		}
+		fail(ctx, err)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/berquerant/k8s-lease/cron"
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/berquerant/k8s-lease/logging"
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/spf13/pflag"
+)
+
+const cronUsage = `klock cron -- run commands on a schedule with mutual exclusion within Kubernetes
+
+# Usage
+
+  klock cron --schedule SCHEDULE [flags] -- command [arguments]
+
+Run the command on the schedule; every replica of klock cron evaluates the schedule,
+and only the winner of the lease runs the command for each tick.
+The lease is annotated with the scheduled time of the tick:
+
+%s
+
+so that the others skip the tick after the winner releases the lease.
+
+SCHEDULE is the standard 5 fields cron expression: minute, hour, day of month, month and day of week,
+or one of @yearly, @monthly, @weekly, @daily and @hourly, evaluated in --timezone.
+
+--missed-ticks decides what to do with the ticks passed while the command was running:
+
+  skip:     ignore them
+  run-once: run the command once for the latest of them
+  run-all:  run the command for each of them, up to %d ticks
+
+# Examples
+
+  klock cron --schedule '*/5 * * * *' -l some-cmd-lease -g -- some_cmd
+
+# Exit status
+
+%d if failure.
+0 if terminated by a signal.
+
+# Flags
+
+`
+
+// missedTicksLimit bounds the ticks run by --missed-ticks run-all.
+const missedTicksLimit = 100
+
+const (
+	missedTicksSkip    = "skip"
+	missedTicksRunOnce = "run-once"
+	missedTicksRunAll  = "run-all"
+)
+
+func runCron(args []string) {
+	fs := newFlagSet("cron")
+	fs.Usage = func() {
+		fmt.Printf(cronUsage, lease.AnnotationScheduledTime, missedTicksLimit, exitCodeFailure)
+		fs.PrintDefaults()
+	}
+	var (
+		kube             = addKubeFlags(fs)
+		name             = fs.StringP("lease", "l", "klock", "The name of a lease.")
+		ident            = addIdentityFlags(fs, "lease holder")
+		scheduleSpec     = fs.String("schedule", "", "The cron expression of the schedule.")
+		timezone         = fs.String("timezone", "Local", "The timezone of --schedule, e.g. UTC, Asia/Tokyo.")
+		missedTicks      = fs.String("missed-ticks", missedTicksSkip, "What to do with the missed ticks: skip, run-once or run-all.")
+		timing           = addLeaseFlags(fs, "leader", "lock")
+		onCancel         = addCancelFlags(fs)
+		additionalLabels = addLabelsFlag(fs)
+	)
+	err := fs.Parse(args)
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
+
+	ctx := newContext()
+
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to parse flags", err))
+	}
+	cmdArgs, err := commandArgs(fs)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: invalid arguments", err))
+	}
+	schedule, err := cron.Parse(*scheduleSpec)
+	if err != nil {
+		fail(ctx, err)
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: invalid timezone", err))
+	}
+	switch *missedTicks {
+	case missedTicksSkip, missedTicksRunOnce, missedTicksRunAll:
+	default:
+		fail(ctx, fmt.Errorf("%w: unknown missed ticks policy: %s", errInvalidFlag, *missedTicks))
+	}
+	identity, err := ident.identity()
+	if err != nil {
+		fail(ctx, err)
+	}
+	warnDefaultIdentity(ctx, identity)
+
+	client, err := kube.newClient(ctx)
+	if err != nil {
+		fail(ctx, err)
+	}
+
+	c := &cronRunner{
+		schedule:    schedule,
+		missedTicks: *missedTicks,
+		newLocker: func(tick, next time.Time) (*lease.Locker, error) {
+			return lease.NewLocker(
+				*kube.namespace, *name, identity, client.CoordinationV1(),
+				append(timing.options(),
+					lease.WithLabels(*additionalLabels),
+					lease.WithScheduledTime(tick),
+					// give up the tick when the next tick comes
+					lease.WithLeaderElectTimeout(time.Until(next)),
+				)...,
+			)
+		},
+		newProcess: func(locker *lease.Locker) *process.Process {
+			proc := process.NewProcess(locker, cmdArgs[0], cmdArgs[1:]...)
+			proc.Stdout = os.Stdout
+			proc.Stderr = os.Stderr
+			onCancel.apply(proc)
+			return proc
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := c.run(ctx, time.Now().In(loc)); err != nil {
+		fail(ctx, err)
+	}
+}
+
+type cronRunner struct {
+	schedule    *cron.Schedule
+	missedTicks string
+	newLocker   func(tick, next time.Time) (*lease.Locker, error)
+	newProcess  func(locker *lease.Locker) *process.Process
+}
+
+// run runs the ticks after start until ctx is canceled.
+func (c *cronRunner) run(ctx context.Context, start time.Time) error {
+	var (
+		logger  = logging.FromContext(ctx).WithValues("schedule", c.schedule)
+		last    = start
+		pending []time.Time
+	)
+	for {
+		var tick time.Time
+		if len(pending) > 0 {
+			tick, pending = pending[0], pending[1:]
+		} else {
+			tick = c.schedule.Next(last)
+			if tick.IsZero() {
+				return fmt.Errorf("%w: no next tick: %s", cron.ErrInvalidSchedule, c.schedule)
+			}
+			logger.V(1).Info("waiting the tick", "tick", tick)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Until(tick)):
+			}
+		}
+
+		if err := c.runTick(ctx, tick); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		last = tick
+
+		if len(pending) > 0 {
+			continue
+		}
+		now := time.Now().In(tick.Location())
+		missed := c.schedule.Between(tick, now, missedTicksLimit)
+		if len(missed) == 0 {
+			continue
+		}
+		logger.V(0).Info("missed ticks", "count", len(missed), "policy", c.missedTicks)
+		switch c.missedTicks {
+		case missedTicksRunOnce:
+			pending = missed[len(missed)-1:]
+		case missedTicksRunAll:
+			pending = missed
+		default:
+			last = now
+		}
+	}
+}
+
+// runTick runs the command for the tick if this replica wins the lease.
+// Returns an error only if the tick cannot be run at all.
+func (c *cronRunner) runTick(ctx context.Context, tick time.Time) error {
+	next := c.schedule.Next(tick)
+	if next.IsZero() || next.Before(time.Now()) {
+		next = time.Now().Add(time.Minute)
+	}
+	locker, err := c.newLocker(tick, next)
+	if err != nil {
+		return fmt.Errorf("%w: failed to create locker", err)
+	}
+	logger := locker.Logger(ctx).WithValues("tick", tick)
+	logger.V(0).Info("tick")
+	err = c.newProcess(locker).Run(ctx)
+	switch {
+	case err == nil:
+		logger.V(0).Info("tick done")
+	case errors.Is(err, lease.ErrSkipped):
+		logger.V(1).Info("tick run by another holder")
+	case errors.Is(err, lease.ErrElectTimedOut):
+		logger.V(0).Info("tick given up, the lease is held until the next tick")
+	default:
+		logger.Error(err, "tick failed", "exitCode", lease.ExitCode(err))
+	}
+	return nil
+}
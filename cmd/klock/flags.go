@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// leaseFlags is the flags of the timing of the leader election.
+type leaseFlags struct {
+	leaseDuration *time.Duration
+	renewDeadline *time.Duration
+	retryPeriod   *time.Duration
+}
+
+// addLeaseFlags adds the flags of the timing of the lock, e.g. "lock", held by the holder, e.g. "leader".
+func addLeaseFlags(fs *pflag.FlagSet, holder, lock string) *leaseFlags {
+	return &leaseFlags{
+		leaseDuration: fs.Duration("lease-duration", lease.DefaultLeaseDuration,
+			fmt.Sprintf("The total time a %s holds the %s before it expires.", holder, lock)),
+		renewDeadline: fs.Duration("renew-deadline", lease.DefaultRenewDeadline,
+			fmt.Sprintf("The time limit for the %s to successfully renew its %s before stepping down.", holder, lock)),
+		retryPeriod: fs.Duration("retry-period", lease.DefaultRetryPeriod,
+			fmt.Sprintf("The time interval between each attempt to acquire or renew the %s.", lock)),
+	}
+}
+
+func (f *leaseFlags) options() []lease.ConfigOption {
+	return []lease.ConfigOption{
+		lease.WithLeaseDuration(*f.leaseDuration),
+		lease.WithRenewDeadline(*f.renewDeadline),
+		lease.WithRetryPeriod(*f.retryPeriod),
+	}
+}
+
+func (f *leaseFlags) workQueueOptions() []lease.WorkQueueConfigOption {
+	return []lease.WorkQueueConfigOption{
+		lease.WithWorkQueueLeaseDuration(*f.leaseDuration),
+		lease.WithWorkQueueRenewDeadline(*f.renewDeadline),
+		lease.WithWorkQueueRetryPeriod(*f.retryPeriod),
+	}
+}
+
+// cancelFlags is the flags of how to stop the command on cancel.
+type cancelFlags struct {
+	killAfter *time.Duration
+	signal    os.Signal
+}
+
+func addCancelFlags(fs *pflag.FlagSet) *cancelFlags {
+	f := &cancelFlags{
+		killAfter: fs.DurationP("kill-after", "k", 0,
+			"Also send a KILL signal if command is still running this long after the initial signal was sent."),
+		signal: syscall.SIGTERM,
+	}
+	fs.FuncP("signal", "s", `Specify the signal to be sent on cancel; SIGNAL may be a name like 'HUP' or a number;
+default is TERM; see 'kill -l' for a list of signals`, signalFlag(&f.signal))
+	return f
+}
+
+// apply sets how to stop the command on cancel.
+func (f *cancelFlags) apply(proc *process.Process) {
+	proc.WaitDelay = *f.killAfter
+	proc.CancelSignal = f.signal
+}
+
+// signalFlag returns the function that parses the signal of the flag into p.
+func signalFlag(p *os.Signal) func(string) error {
+	return func(v string) error {
+		if x, ok := process.NewSignal(v); ok {
+			*p = x
+			return nil
+		}
+		return errors.New("UnknownSignal")
+	}
+}
+
+// addLabelsFlag adds the flag of the additional labels of the leases.
+func addLabelsFlag(fs *pflag.FlagSet) *labels.Set {
+	var x labels.Set
+	fs.Func("labels", "The additional labels of the leases.", func(v string) error {
+		s, err := lease.ParseLabelsFromString(v)
+		if err != nil {
+			return err
+		}
+		x = s
+		return nil
+	})
+	return &x
+}
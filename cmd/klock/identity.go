@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/berquerant/k8s-lease/kconfig"
+	"github.com/berquerant/k8s-lease/logging"
+	"github.com/google/uuid"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// defaultIdentity is shared by all the processes unless the identity is given.
+	defaultIdentity = "klock"
+	// defaultInClusterIdentityTemplate is used in the cluster unless the identity is given.
+	defaultInClusterIdentityTemplate = "{{or .PodName .Hostname}}-{{.Random}}"
+)
+
+// identityFlags is the flags to decide the identity.
+type identityFlags struct {
+	fs       *pflag.FlagSet
+	id       *string
+	generate *bool
+	template *string
+}
+
+// addIdentityFlags adds the identity flags; role is the noun of the identity owner, e.g. "lease holder".
+func addIdentityFlags(fs *pflag.FlagSet, role string) *identityFlags {
+	return &identityFlags{
+		fs:       fs,
+		id:       fs.StringP("identity", "i", defaultIdentity, fmt.Sprintf("The id of a %s.", role)),
+		generate: fs.BoolP("generate-identity", "g", false, fmt.Sprintf("If true, generate a %s identity by uuid.", role)),
+		template: fs.String("identity-template", "", fmt.Sprintf(`The template of the id of a %s.
+Available fields: {{.PodName}}, {{.PodNamespace}}, {{.NodeName}}, {{.Hostname}}, {{.PID}} and {{.Random}}.`, role)),
+	}
+}
+
+// identity returns the identity given by -g, --identity-template or -i.
+// If none of them is given, returns the identity by the default template in the cluster, otherwise the default identity.
+func (f *identityFlags) identity() (string, error) {
+	if *f.template != "" && (*f.generate || f.fs.Changed("identity")) {
+		return "", fmt.Errorf("%w: --identity-template with -i or -g", errConflictingFlags)
+	}
+	switch {
+	case *f.generate:
+		return uuid.Must(uuid.NewRandom()).String(), nil
+	case *f.template != "":
+		return executeIdentityTemplate(*f.template)
+	case f.fs.Changed("identity"):
+		return *f.id, nil
+	case kconfig.InCluster():
+		return executeIdentityTemplate(defaultInClusterIdentityTemplate)
+	default:
+		return *f.id, nil
+	}
+}
+
+// identityData is the data for the template of the identity.
+type identityData struct {
+	// PodName is $POD_NAME, e.g. from the downward API.
+	PodName string
+	// PodNamespace is $POD_NAMESPACE.
+	PodNamespace string
+	// NodeName is $NODE_NAME.
+	NodeName string
+	Hostname string
+	PID      int
+	// Random is the random string of 8 characters.
+	Random string
+}
+
+func newIdentityData() identityData {
+	hostname, _ := os.Hostname()
+	return identityData{
+		PodName:      os.Getenv("POD_NAME"),
+		PodNamespace: os.Getenv("POD_NAMESPACE"),
+		NodeName:     os.Getenv("NODE_NAME"),
+		Hostname:     hostname,
+		PID:          os.Getpid(),
+		Random:       strings.ToLower(rand.Text()[:8]),
+	}
+}
+
+func executeIdentityTemplate(text string) (string, error) {
+	tmpl, err := template.New("identity").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid identity template: %w", errInvalidFlag, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, newIdentityData()); err != nil {
+		return "", fmt.Errorf("%w: invalid identity template: %w", errInvalidFlag, err)
+	}
+	id := strings.TrimSpace(b.String())
+	if id == "" {
+		return "", fmt.Errorf("%w: identity template results in the empty identity", errInvalidFlag)
+	}
+	return id, nil
+}
+
+// warnDefaultIdentity warns that the processes with the default identity are regarded as the same holder.
+func warnDefaultIdentity(ctx context.Context, id string) {
+	if id != defaultIdentity {
+		return
+	}
+	logging.FromContext(ctx).Error(nil,
+		"WARNING: the default identity is used; the processes with the same identity are regarded as the same holder and fail on collision, use -i, -g or --identity-template",
+		"identity", id)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/berquerant/k8s-lease/kconfig"
+	"github.com/berquerant/k8s-lease/logging"
+	"github.com/berquerant/k8s-lease/version"
+	"github.com/spf13/pflag"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// newFlagSet returns the flag set with the klog flags.
+func newFlagSet(name string) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ExitOnError)
+	klogFlags := flag.NewFlagSet("klog", flag.ExitOnError)
+	klog.InitFlags(klogFlags)
+	fs.AddGoFlagSet(klogFlags)
+	return fs
+}
+
+func newContext() context.Context {
+	return klog.NewContext(context.Background(), klog.NewKlogr().WithName("klock"))
+}
+
+// kubeFlags is the flags to access the cluster.
+type kubeFlags struct {
+	kubeconfig *string
+	inCluster  *string
+	namespace  *string
+	context    *string
+	cluster    *string
+	user       *string
+	as         *string
+	asGroups   *[]string
+	token      *string
+	server     *string
+	qps        *float32
+	burst      *int
+	timeout    *time.Duration
+}
+
+func addKubeFlags(fs *pflag.FlagSet) *kubeFlags {
+	return &kubeFlags{
+		kubeconfig: fs.String("kubeconfig", "", "The path of the kubeconfig file. Default is $KUBECONFIG, the files merged, or ~/.kube/config."),
+		inCluster: fs.String("in-cluster", string(kconfig.InClusterAuto), `Whether to use the in-cluster config: auto, true or false.
+auto uses it in the cluster unless --kubeconfig or --context is given.`),
+		namespace: fs.StringP("namespace", "n", "", `The namespace of a lease.
+Default is the namespace of the service account in the cluster, otherwise the namespace of the kubeconfig context, or default.`),
+		context:  fs.String("context", "", "The name of the kubeconfig context to use."),
+		cluster:  fs.String("cluster", "", "The name of the kubeconfig cluster to use."),
+		user:     fs.String("user", "", "The name of the kubeconfig user to use."),
+		as:       fs.String("as", "", "Username to impersonate for the operation."),
+		asGroups: fs.StringArray("as-group", nil, "Group to impersonate for the operation, this flag can be repeated to specify multiple groups."),
+		token:    fs.String("token", "", "Bearer token for authentication to the API server."),
+		server:   fs.String("server", "", "The address and port of the Kubernetes API server."),
+		qps:      fs.Float32("kube-api-qps", rest.DefaultQPS, "The maximum queries per second to the Kubernetes API server."),
+		burst:    fs.Int("kube-api-burst", rest.DefaultBurst, "The maximum burst of the queries to the Kubernetes API server."),
+		timeout:  fs.Duration("request-timeout", 30*time.Second, "The time limit of each request to the Kubernetes API server. 0 means no limit."),
+	}
+}
+
+func (f *kubeFlags) options() (*kconfig.Options, error) {
+	inCluster, err := kconfig.ParseInClusterMode(*f.inCluster)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidFlag, err)
+	}
+	return &kconfig.Options{
+		InCluster:         inCluster,
+		Kubeconfig:        *f.kubeconfig,
+		Context:           *f.context,
+		Cluster:           *f.cluster,
+		User:              *f.user,
+		Impersonate:       *f.as,
+		ImpersonateGroups: *f.asGroups,
+		Token:             *f.token,
+		Server:            *f.server,
+		QPS:               *f.qps,
+		Burst:             *f.burst,
+		Timeout:           *f.timeout,
+		UserAgent:         "klock/" + version.Version,
+	}, nil
+}
+
+// newClient returns the client, and sets the namespace resolved by kconfig if not given.
+func (f *kubeFlags) newClient(ctx context.Context) (*clientset.Clientset, error) {
+	opts, err := f.options()
+	if err != nil {
+		return nil, err
+	}
+	if *f.namespace == "" {
+		*f.namespace = kconfig.Namespace(opts)
+	}
+	kubeconfig, source, err := kconfig.Build(opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to build kubeconfig", err)
+	}
+	logger := logging.FromContext(ctx)
+	switch source {
+	case kconfig.SourceInCluster:
+		logger.V(0).Info("kubeconfig", "source", source, "server", kubeconfig.Host, "namespace", *f.namespace)
+	default:
+		logger.V(0).Info("kubeconfig", "source", source, "context", opts.CurrentContext(), "server", kubeconfig.Host, "namespace", *f.namespace)
+	}
+	client, err := clientset.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create client", err)
+	}
+	return client, nil
+}
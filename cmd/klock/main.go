@@ -3,26 +3,27 @@ package main
 import (
 	"context"
 	"errors"
-	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
-	"github.com/berquerant/k8s-lease/kconfig"
 	"github.com/berquerant/k8s-lease/lease"
 	"github.com/berquerant/k8s-lease/logging"
 	"github.com/berquerant/k8s-lease/process"
 	versionpkg "github.com/berquerant/k8s-lease/version"
-	"github.com/google/uuid"
 	"github.com/spf13/pflag"
-	"k8s.io/apimachinery/pkg/labels"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 )
 
-const exitCodeFailure = 1
+const (
+	exitCodeFailure          = 1
+	exitCodeHeartbeatTimeout = 124
+)
 
 func fail(ctx context.Context, err error) {
 	failWith(ctx, exitCodeFailure, err)
@@ -39,11 +40,19 @@ const usage = `klock -- manage locks from shell scripts within Kubernetes
 # Usage
 
   klock [flags] -- command [arguments]
+  klock status [flags]
+  klock barrier --name NAME --parties N [flags]
+  klock ratelimit --name NAME --rate RATE [flags] -- command [arguments]
+  klock cron --schedule SCHEDULE [flags] -- command [arguments]
+  klock xargs --lease-template TEMPLATE [flags] -- command [arguments]
+  klock work --name NAME --items-file FILE [flags] -- command [arguments]
 
 klock manages the Kubernetes lease locks from shell scripts or from the command line.
 
 klock runs the provided command (or a command with arguments) with mutual exclusion guaranteed by a lease.
 klock acquires a lock via a holder identity from a lease, which is created if it does not already exist.
+The name of the lease should be a DNS-1123 subdomain, lowercase alphanumerics, '-' or '.', like the other Kubernetes objects;
+klock fails before running the command otherwise.
 
 The following labels are always applied to leases created by klock:
 
@@ -54,10 +63,22 @@ The following labels are always applied to leases created by klock:
 Suppose you have a command, some_cmd, that you want to run regularly but not concurrently.
 You can execute multiple instances of some_cmd exclusively using klock.
 
-  klock -l some_cmd_lease -i "$(uuidgen)" -- some_cmd
+  klock -l some-cmd-lease -i "$(uuidgen)" -- some_cmd
 
 A unique uuid is associated with the execution of some_cmd as the holder identity.
 
+--identity-template builds the identity from the environment, e.g. the pod name given by the downward API:
+
+  klock -l some-cmd-lease --identity-template '{{.PodName}}-{{.PID}}-{{.Random}}' -- some_cmd
+
+In the cluster, the identity defaults to %q unless -i, -g or --identity-template is given.
+
+The processes with the same identity are regarded as the same holder by the lease.
+klock annotates the lease with a nonce per process, %s,
+and fails when it finds the lease held by another process with the same identity,
+including the lease left by a killed process until it expires.
+klock warns when the default identity %q is used out of the cluster.
+
 # Permissions
 
 The execution of klock requires permissions similar to the following role:
@@ -72,72 +93,197 @@ rules:
     verbs: ["create", "get", "update", "patch"]
 
 If you use --cleanup-lease, please add delete to the verbs.
+If you use --save-output-configmap, please add the following rule:
+
+  - apiGroups: [""]
+    resources: ["configmaps"]
+    verbs: ["create", "get", "update"]
+
+# Last run
+
+With --record-last-run, klock records the result of the command on the lease annotations when releasing it:
+
+%s
+
+The annotations are kept across runs, so --record-last-run cannot be used with --cleanup-lease.
+klock status displays them.
+
+With --min-interval, klock runs the command at most once per the interval:
+after acquiring the lock, klock exits with --skipped-exit-code without running the command
+if the last success is within the interval. --min-interval implies --record-last-run.
+
+  klock -l some-cmd-lease -g --min-interval 1h -- some_cmd
+
+# Once
+
+With --once-key, klock runs the command at most once per the key:
+after the command exits with 0, klock records the completion of the key on the companion lease named <lease>-once,
+which is not deleted by --cleanup-lease.
+Later runs exit with --skipped-exit-code without running the command, unless --force is given.
+
+  klock -l migration -g --once-key v2 -- migrate
+
+# Hooks
+
+--pre-hook, --post-hook and --on-failure-hook run within the same lease hold as the command.
+The post hooks receive the exit status of the command through the environment variable %s.
+
+# Heartbeat
+
+With --heartbeat-timeout, the command must send heartbeats periodically:
+
+  file:   touch the file at $%s
+  fd:     write to the file descriptor $%s
+  socket: write to the unix socket $%s
+
+If the command misses heartbeats for the duration, klock stops renewing and releases the lease,
+stops the command in the same way as on cancel, kills it after --kill-after (10s if 0),
+and exits with --heartbeat-exit-code. The command is not retried nor restarted.
+
+# Restart
+
+With --restart, klock keeps the lock and restarts the command when it exits:
+
+  on-failure: restart the command if it fails
+  always:     restart the command whenever it exits
+
+The delay before a restart starts at --restart-backoff and is doubled on each restart,
+reset if the command has run longer than --crash-loop-window.
+If the command exits more than --crash-loop-threshold times within --crash-loop-window, klock gives up the lock and fails.
+If the leadership is lost, klock stops the command and waits for the lock again.
+
+  klock -l some-daemon-lease -g --restart always -- some_daemon
+
+# Campaign
+
+With --campaign, klock never exits on the end of the lock:
+after the command exits or the leadership is lost, klock waits for --campaign-backoff and campaigns for the lock again.
+The number of the terms is logged. klock exits with 0 on a signal,
+with --heartbeat-exit-code if the command misses the heartbeats, or fails if the command cannot be started.
+
+  klock -l some-service-lease -g --campaign -- some_service
+
+# Reentrant
+
+With --reentrant, a klock called within the command of another klock holding the same lease with the same identity
+runs its command immediately, instead of waiting for itself.
+The number of the nested klocks is recorded on the lease annotation %s.
+The lease is released only when the outermost klock exits; the nested commands are stopped then.
+
+  klock -l deploy -i "$(hostname)" --reentrant -- deploy_all  # calls klock -l deploy -i "$(hostname)" --reentrant -- deploy_one
+
+# Shards
+
+With --shard-key and --shards, klock locks the key on one of the fixed leases <lease>-shard-0 to <lease>-shard-(M-1),
+chosen by the hash of the key, instead of a lease per key.
+The keys on the same shard exclude each other; such false contention is logged with the key holding the shard.
+
+  klock -l tenant --shard-key tenant-a --shards 16 -g -- some_cmd
 
 # Exit status
 
 %d if failure.
 The exit status of the given command, if klock executed it.
+With --retries, the exit status of the last attempt; the number of attempts is logged.
+128+N if the command was terminated by the signal N, like shells.
+--heartbeat-exit-code if the command misses heartbeats.
+--skipped-exit-code if the command is skipped by --min-interval or --once-key.
 
 # Flags
 
 `
 
+// subcommands are selected by the first argument.
+var subcommands = map[string]func(args []string){
+	"status":    runStatus,
+	"barrier":   runBarrier,
+	"ratelimit": runRateLimit,
+	"cron":      runCron,
+	"xargs":     runXargs,
+	"work":      runWork,
+}
+
 func main() {
-	fs := pflag.NewFlagSet("main", pflag.ExitOnError)
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			run(os.Args[1:])
+			return
+		}
+	}
+
+	fs := newFlagSet("main")
 	fs.Usage = func() {
-		fmt.Printf(usage, lease.LabelsIntoString(lease.CommonLabels()), exitCodeFailure)
+		fmt.Printf(usage, lease.LabelsIntoString(lease.CommonLabels()), defaultInClusterIdentityTemplate, lease.AnnotationHolderNonce, defaultIdentity, lastRunAnnotations(), process.EnvExitCode,
+			process.EnvHeartbeatFile, process.EnvHeartbeatFD, process.EnvHeartbeatSocket,
+			lease.AnnotationReentrantDepth, exitCodeFailure)
 		fs.PrintDefaults()
 	}
-	{
-		klogFlags := flag.NewFlagSet("klog", flag.ExitOnError)
-		klog.InitFlags(klogFlags)
-		fs.AddGoFlagSet(klogFlags)
-	}
 	var (
-		kubeconfigPath = fs.String("kubeconfig", "", "")
-		namespace      = fs.StringP("namespace", "n", "default", "The namespace of a lease.")
-		name           = fs.StringP("lease", "l", "klock", "The name of a lease.")
-		id             = fs.StringP("identity", "i", "klock", "The id of a lease holder.")
-		generateID     = fs.BoolP("generate-identity", "g", false, "If true, generate a holder identity by uuid.")
-		cleanupLease   = fs.Bool("cleanup-lease", false, "If true, delete the created lease after processing.")
-		unlock         = fs.BoolP("unlock", "u", false, "Same as --cleanup-lease.")
-		wait           = fs.DurationP("wait", "w", 0,
+		kube         = addKubeFlags(fs)
+		name         = fs.StringP("lease", "l", "klock", "The name of a lease.")
+		ident        = addIdentityFlags(fs, "lease holder")
+		cleanupLease = fs.Bool("cleanup-lease", false, "If true, delete the created lease after processing.")
+		unlock       = fs.BoolP("unlock", "u", false, "Same as --cleanup-lease.")
+		wait         = fs.DurationP("wait", "w", 0,
 			`Fail if the lock cannot be acquired within the duration.
 0 means wait infinitely.`)
 		timeout          = fs.Duration("timeout", 0, "Same as --wait.")
 		conflictExitCode = fs.Uint8P("conflict-exit-code", "E", exitCodeFailure,
 			`The exit status used when the -w option is in use, and the timeout is reached.`)
-		killAfter = fs.DurationP("kill-after", "k", 0,
-			"Also send a KILL signal if command is still running this long after the initial signal was sent.")
-		leaseDuration              = fs.Duration("lease-duration", lease.DefaultLeaseDuration, "The total time a leader node holds the lock before it expires.")
-		renewDeadline              = fs.Duration("renew-deadline", lease.DefaultRenewDeadline, "The time limit for the leader to successfully renew its lock before stepping down.")
-		retryPeriod                = fs.Duration("retry-period", lease.DefaultRetryPeriod, "The time interval between each attempt to acquire or renew the lock.")
-		version                    = fs.BoolP("version", "V", false, "Display version and exit.")
-		cancelSignal     os.Signal = syscall.SIGTERM
-		additionalLabels labels.Set
+		onCancel             = addCancelFlags(fs)
+		timing               = addLeaseFlags(fs, "leader", "lock")
+		additionalLabels     = addLabelsFlag(fs)
+		retries              = fs.Int("retries", 0, "The maximum number of times to re-run the failed command while holding the lock.")
+		retryBackoff         = fs.Duration("retry-backoff", time.Second, fmt.Sprintf("The delay before the first retry, doubled on each subsequent retry up to %s.", process.MaxBackoff))
+		retryOnExitCodes     = fs.IntSlice("retry-on-exit-codes", nil, "Retry only when the command exits with one of these statuses; default is any non-zero status.")
+		preHook              = fs.String("pre-hook", "", "The shell script run before the command while holding the lock. If it fails, the command is not run.")
+		preHookTimeout       = fs.Duration("pre-hook-timeout", 0, "The time limit of --pre-hook. 0 means no limit.")
+		postHook             = fs.String("post-hook", "", "The shell script run after the command while holding the lock, even if the command fails.")
+		postHookTimeout      = fs.Duration("post-hook-timeout", 0, "The time limit of --post-hook. 0 means no limit.")
+		onFailureHook        = fs.String("on-failure-hook", "", "The shell script run after the command while holding the lock, only if the command fails.")
+		onFailureHookTimeout = fs.Duration("on-failure-hook-timeout", 0, "The time limit of --on-failure-hook. 0 means no limit.")
+		heartbeatTimeout     = fs.Duration("heartbeat-timeout", 0, `Stop the command and release the lock if the command misses heartbeats for the duration.
+0 means no watchdog.`)
+		heartbeatMode     = fs.String("heartbeat-mode", string(process.HeartbeatFile), "How the command sends heartbeats: file, fd or socket.")
+		heartbeatPath     = fs.String("heartbeat-path", "", "The heartbeat file or socket path. A temporary path is used if empty.")
+		heartbeatExitCode = fs.Uint8("heartbeat-exit-code", exitCodeHeartbeatTimeout, "The exit status used when the command misses heartbeats.")
+		warnFraction      = fs.Float64("warn-fraction", 0.5, "The fraction of --renew-deadline for which the renewal can fail or hang after --retry-period before --warn-signal is sent.")
+		report            = fs.Bool("report", false, "If true, write the summary of the command execution to stderr.")
+		outputPrefix      = fs.String("output-prefix", "", `The template of the prefix of each line of the command output.
+Available fields: {{.Namespace}}, {{.Name}} (lease), {{.Identity}}, {{.Stream}} and {{.Timestamp}}.`)
+		outputLog           = fs.Bool("output-log", false, "If true, emit each line of the command output as a log record with the lease fields instead.")
+		teeStdout           = fs.String("tee-stdout", "", "Also write stdout of the command to the file.")
+		teeStderr           = fs.String("tee-stderr", "", "Also write stderr of the command to the file.")
+		teeMaxSize          = fs.Int64("tee-max-size", 0, "Rotate the --tee-stdout and --tee-stderr files when they grow beyond the bytes. 0 means no rotation.")
+		teeMaxBackups       = fs.Int("tee-max-backups", 3, "The number of rotated files to keep.")
+		saveOutputConfigMap = fs.String("save-output-configmap", "", `Save the last lines of the command output, the exit status and the timing to the ConfigMap in the namespace of the lease.`)
+		saveOutputLines     = fs.Int("save-output-lines", 100, fmt.Sprintf("The number of the last lines saved by --save-output-configmap; only the tail within %d bytes is saved.", process.MaxOutputBytes))
+		recordLastRun       = fs.Bool("record-last-run", false, "If true, record the result of the command on the lease annotations when releasing it. See klock status.")
+		minInterval         = fs.Duration("min-interval", 0, `Skip the command if the last success recorded on the lease is within the duration.
+0 means no limit.`)
+		skippedExitCode    = fs.Uint8("skipped-exit-code", 0, "The exit status used when the command is skipped by --min-interval or --once-key.")
+		onceKey            = fs.String("once-key", "", "Run the command only if the key has not been completed, and record the completion on success.")
+		force              = fs.Bool("force", false, "If true, run the command even if --once-key has been completed.")
+		restart            = fs.String("restart", "", "Restart the command while holding the lock: on-failure or always. Default is no restart.")
+		restartBackoff     = fs.Duration("restart-backoff", time.Second, fmt.Sprintf("The delay before the first restart, doubled on each subsequent restart up to %s.", process.MaxBackoff))
+		crashLoopThreshold = fs.Int("crash-loop-threshold", process.DefaultCrashLoopThreshold, "Give up the lock if the command exits more than this times within --crash-loop-window. 0 means no limit.")
+		crashLoopWindow    = fs.Duration("crash-loop-window", process.DefaultCrashLoopWindow, "The window of --crash-loop-threshold.")
+		campaign           = fs.Bool("campaign", false, "If true, campaign for the lock again after the command exits or the leadership is lost, until a signal.")
+		campaignBackoff    = fs.Duration("campaign-backoff", time.Second, "The delay before campaigning again with --campaign.")
+		reentrant          = fs.Bool("reentrant", false, "If true, run the command immediately if the lease is already held by the same identity, e.g. by the calling klock.")
+		shardKey           = fs.String("shard-key", "", "Lock the key on one of the --shards leases named <lease>-shard-N instead of the lease itself.")
+		shards             = fs.Int("shards", 0, "The number of the shards of --shard-key.")
+		version            = fs.BoolP("version", "V", false, "Display version and exit.")
+		warnSignal         os.Signal
 	)
-	fs.Func("labels", "The additional labels of a lease", func(v string) error {
-		x, err := lease.ParseLabelsFromString(v)
-		if err != nil {
-			return err
-		}
-		additionalLabels = x
-		return nil
-	})
-	fs.FuncP("signal", "s", `Specify the signal to be sent on cancel; SIGNAL may be a name like 'HUP' or a number;
-default is TERM; see 'kill -l' for a list of signals`, func(v string) error {
-		if x, ok := process.NewSignal(v); ok {
-			cancelSignal = x
-			return nil
-		}
-		return errors.New("UnknownSignal")
-	})
+	fs.Func("warn-signal", `Specify the signal to be sent when the renewal of the lease has been failing or hanging,
+before the leadership is lost, at most once per attempt of --retries; e.g. 'USR1'; default is none`, signalFlag(&warnSignal))
 	err := fs.Parse(os.Args)
 	if errors.Is(err, pflag.ErrHelp) {
 		return
 	}
 
-	ctx := klog.NewContext(context.Background(), klog.NewKlogr().WithName("klock"))
+	ctx := newContext()
 
 	if err != nil {
 		fail(ctx, fmt.Errorf("%w: failed to parse flags", err))
@@ -153,52 +299,146 @@ default is TERM; see 'kill -l' for a list of signals`, func(v string) error {
 	if err != nil {
 		fail(ctx, fmt.Errorf("%w: invalid program and arguments to be executed", err))
 	}
-
-	kubeconfig, err := kconfig.Build(*kubeconfigPath)
+	if *shards != 0 && *shardKey == "" {
+		fail(ctx, fmt.Errorf("%w: --shards without --shard-key", errInvalidFlag))
+	}
+	identity, err := ident.identity()
 	if err != nil {
-		fail(ctx, fmt.Errorf("%w: failed to build kubeconfig", err))
+		fail(ctx, err)
 	}
-	client, err := clientset.NewForConfig(kubeconfig)
+	warnDefaultIdentity(ctx, identity)
+
+	client, err := kube.newClient(ctx)
 	if err != nil {
-		fail(ctx, fmt.Errorf("%w: failed to create client", err))
+		fail(ctx, err)
 	}
-	locker, err := lease.NewLocker(
-		*namespace, *name, holderIdentity(*id, *generateID), client.CoordinationV1(),
+	lockerOpts := append(timing.options(),
 		lease.WithCleanupLease(*cleanupLease || *unlock),
-		lease.WithLabels(additionalLabels),
-		lease.WithLeaseDuration(*leaseDuration),
-		lease.WithRenewDeadline(*renewDeadline),
-		lease.WithRetryPeriod(*retryPeriod),
+		lease.WithLabels(*additionalLabels),
 		lease.WithLeaderElectTimeout(max(*wait, *timeout)),
+		lease.WithRenewWarningFraction(renewWarningFraction(warnSignal, *warnFraction)),
+		lease.WithRecordLastRun(*recordLastRun),
+		lease.WithMinInterval(*minInterval),
+		lease.WithReentrant(*reentrant),
 	)
+	var locker *lease.Locker
+	if *shardKey != "" {
+		locker, err = lease.NewShardedLocker(
+			*kube.namespace, *name, *shardKey, identity, *shards, client.CoordinationV1(), lockerOpts...)
+	} else {
+		locker, err = lease.NewLocker(
+			*kube.namespace, *name, identity, client.CoordinationV1(), lockerOpts...)
+	}
 	if err != nil {
 		fail(ctx, fmt.Errorf("%w: failed to create locker", err))
 	}
-	proc := process.NewProcess(locker, args[0], args[1:]...)
+	outs, err := newOutputs(ctx, outputConfig{
+		prefix:        *outputPrefix,
+		log:           *outputLog,
+		teeStdout:     *teeStdout,
+		teeStderr:     *teeStderr,
+		teeMaxSize:    *teeMaxSize,
+		teeMaxBackups: *teeMaxBackups,
+		tailLines:     tailLines(*saveOutputConfigMap, *saveOutputLines),
+	}, locker)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to prepare outputs", err))
+	}
+	var procLocker process.Locker = locker
+	if *onceKey != "" {
+		once, err := lease.NewOnce(locker, *onceKey, *force)
+		if err != nil {
+			fail(ctx, fmt.Errorf("%w: failed to create once", err))
+		}
+		procLocker = once
+	}
+	if *campaign {
+		if *onceKey != "" {
+			fail(ctx, fmt.Errorf("%w: --campaign with --once-key", errConflictingFlags))
+		}
+		procLocker = lease.NewForever(locker, *campaignBackoff)
+	}
+	proc := process.NewProcess(procLocker, args[0], args[1:]...)
 	proc.Stdin = os.Stdin
-	proc.Stdout = os.Stdout
-	proc.Stderr = os.Stderr
-	proc.WaitDelay = *killAfter
-	proc.CancelSignal = cancelSignal
+	proc.Stdout = outs.stdout
+	proc.Stderr = outs.stderr
+	onCancel.apply(proc)
+	proc.WarnSignal = warnSignal
+	proc.Restart = process.RestartPolicy(*restart)
+	proc.RestartBackoff = *restartBackoff
+	proc.CrashLoopThreshold = *crashLoopThreshold
+	proc.CrashLoopWindow = *crashLoopWindow
+	proc.Retries = *retries
+	proc.RetryBackoff = *retryBackoff
+	proc.RetryOnExitCodes = *retryOnExitCodes
+	proc.PreHook = shellHook(*preHook, *preHookTimeout)
+	proc.PostHook = shellHook(*postHook, *postHookTimeout)
+	proc.OnFailureHook = shellHook(*onFailureHook, *onFailureHookTimeout)
+	if *heartbeatTimeout > 0 {
+		proc.Heartbeat = &process.Heartbeat{
+			Mode:    process.HeartbeatMode(*heartbeatMode),
+			Path:    *heartbeatPath,
+			Timeout: *heartbeatTimeout,
+		}
+	}
 	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer stop() // in case of panic
 	err = proc.Run(ctx)
+	// stop cancels ctx, so check the signal before it
+	interrupted := ctx.Err() != nil
 	stop() // release before os.Exit paths in error handling below
+	if err := outs.Close(); err != nil {
+		logging.FromContext(ctx).Error(err, "failed to close outputs")
+	}
+	if name := *saveOutputConfigMap; name != "" && proc.Report().Attempts > 0 {
+		if err := saveOutput(ctx, client, locker, name, proc.Report(), outs.tail.Lines()); err != nil {
+			logging.FromContext(ctx).Error(err, "failed to save output", "configmap", name)
+		}
+	}
+	if *report {
+		if err := proc.Report().Write(os.Stderr); err != nil {
+			logging.FromContext(ctx).Error(err, "failed to write report")
+		}
+	}
 	if err != nil {
+		if *campaign && interrupted {
+			// the campaign ends only on a signal
+			logging.FromContext(ctx).V(0).Info("campaign stopped")
+			return
+		}
+		if errors.Is(err, lease.ErrSkipped) {
+			logging.FromContext(ctx).V(0).Info("skipped", "reason", err.Error())
+			klog.FlushAndExit(klog.ExitFlushTimeout, int(*skippedExitCode))
+		}
 		if errors.Is(err, lease.ErrElectTimedOut) {
 			failWith(ctx, int(*conflictExitCode), err)
 		}
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			failWith(ctx, exitErr.ExitCode(), err)
+		if errors.Is(err, process.ErrHeartbeatTimeout) {
+			failWith(ctx, int(*heartbeatExitCode), err)
 		}
-		fail(ctx, err)
+		failCommand(ctx, err)
 	}
 }
 
+// failCommand exits with the exit status of the command if err comes from the command.
+func failCommand(ctx context.Context, err error) {
+	var sigErr *process.SignalError
+	if errors.As(err, &sigErr) {
+		failWith(ctx, sigErr.ExitCode(), err)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		failWith(ctx, exitErr.ExitCode(), err)
+	}
+	fail(ctx, err)
+}
+
 var (
 	errNoProgram         = errors.New("NoProgram")
 	errProgramBeforeDash = errors.New("ProgramBeforeDash")
+	errUnexpectedArgs    = errors.New("UnexpectedArgs")
+	errConflictingFlags  = errors.New("ConflictingFlags")
+	errInvalidFlag       = errors.New("InvalidFlag")
 )
 
 func commandArgs(fs *pflag.FlagSet) ([]string, error) {
@@ -216,9 +456,52 @@ func commandArgs(fs *pflag.FlagSet) ([]string, error) {
 	return args, nil
 }
 
-func holderIdentity(id string, generate bool) string {
-	if generate {
-		return uuid.Must(uuid.NewRandom()).String()
+func shellHook(script string, timeout time.Duration) *process.Hook {
+	if script == "" {
+		return nil
+	}
+	return process.NewShellHook(script, timeout)
+}
+
+func renewWarningFraction(warnSignal os.Signal, fraction float64) float64 {
+	if warnSignal == nil {
+		return 0
+	}
+	return fraction
+}
+
+func tailLines(configMap string, lines int) int {
+	if configMap == "" {
+		return 0
 	}
-	return id
+	return lines
+}
+
+// saveOutputTimeout is the timeout for saving the output to the ConfigMap.
+const saveOutputTimeout = 5 * time.Second
+
+func saveOutput(ctx context.Context, client *clientset.Clientset, locker *lease.Locker, name string, report process.Report, lines []string) error {
+	// save even if klock is interrupted
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), saveOutputTimeout)
+	defer cancel()
+	c := &process.OutputConfigMap{
+		Client:    client.CoreV1(),
+		Namespace: locker.Namespace(),
+		Name:      name,
+		Labels:    locker.Labels(),
+	}
+	return c.Save(ctx, report, lines, map[string]string{
+		"lease":    locker.Name(),
+		"identity": locker.ID(),
+	})
+}
+
+func lastRunAnnotations() string {
+	return strings.Join([]string{
+		lease.AnnotationLastRunStart,
+		lease.AnnotationLastRunEnd,
+		lease.AnnotationLastExitCode,
+		lease.AnnotationLastHolder,
+		lease.AnnotationLastSuccessTime,
+	}, "\n")
 }
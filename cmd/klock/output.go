@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/berquerant/k8s-lease/process"
+)
+
+type outputConfig struct {
+	prefix        string
+	log           bool
+	teeStdout     string
+	teeStderr     string
+	teeMaxSize    int64
+	teeMaxBackups int
+	tailLines     int
+}
+
+// outputs is the destinations of stdout and stderr of the command.
+type outputs struct {
+	stdout  io.Writer
+	stderr  io.Writer
+	writers []io.Closer // flushed before files are closed
+	files   []io.Closer
+	// tail keeps the last lines of the output if not nil.
+	tail *process.TailBuffer
+}
+
+func (o *outputs) Close() error {
+	var errs []error
+	for _, x := range o.writers {
+		errs = append(errs, x.Close())
+	}
+	for _, x := range o.files {
+		errs = append(errs, x.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func newOutputs(ctx context.Context, c outputConfig, locker *lease.Locker) (*outputs, error) {
+	var (
+		o     = &outputs{}
+		files = map[string]*process.RotatingFile{}
+		tee   = func(path string) (io.Writer, error) {
+			if path == "" {
+				return nil, nil
+			}
+			if f, ok := files[path]; ok {
+				return f, nil
+			}
+			f, err := process.NewRotatingFile(path, c.teeMaxSize, c.teeMaxBackups)
+			if err != nil {
+				return nil, err
+			}
+			files[path] = f
+			o.files = append(o.files, f)
+			return f, nil
+		}
+		newWriter = func(console io.Writer, stream, teePath string) (io.Writer, error) {
+			w := console
+			switch {
+			case c.log:
+				x := process.NewLogWriter(locker.Logger(ctx), stream)
+				o.writers = append(o.writers, x)
+				w = x
+			case c.prefix != "":
+				prefix, err := process.NewTemplatePrefix(c.prefix, process.PrefixData{
+					Namespace: locker.Namespace(),
+					Name:      locker.Name(),
+					Identity:  locker.ID(),
+					Stream:    stream,
+				})
+				if err != nil {
+					return nil, err
+				}
+				x := process.NewPrefixWriter(console, prefix)
+				o.writers = append(o.writers, x)
+				w = x
+			}
+			f, err := tee(teePath)
+			if err != nil {
+				return nil, err
+			}
+			if f != nil {
+				w = io.MultiWriter(w, f)
+			}
+			if o.tail != nil {
+				x := o.tail.Writer()
+				o.writers = append(o.writers, x)
+				w = io.MultiWriter(w, x)
+			}
+			return w, nil
+		}
+	)
+
+	if c.tailLines > 0 {
+		o.tail = process.NewTailBuffer(c.tailLines)
+	}
+	var err error
+	if o.stdout, err = newWriter(os.Stdout, "stdout", c.teeStdout); err != nil {
+		return nil, errors.Join(err, o.Close())
+	}
+	if o.stderr, err = newWriter(os.Stderr, "stderr", c.teeStderr); err != nil {
+		return nil, errors.Join(err, o.Close())
+	}
+	return o, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/spf13/pflag"
+)
+
+const rateLimitUsage = `klock ratelimit -- limit the rate of commands within Kubernetes
+
+# Usage
+
+  klock ratelimit --name NAME --rate RATE [flags] -- command [arguments]
+
+Run the command after taking a token from the token bucket NAME shared by all the clients.
+The bucket holds up to --burst tokens and is refilled at --rate.
+RATE is COUNT/UNIT, UNIT is s, m, h or a duration like 30s.
+
+If no token is available, wait for a token, or fail with --no-wait.
+
+The bucket is stored on the annotations of the lease NAME, a DNS-1123 subdomain:
+
+%s
+
+# Examples
+
+Run some_cmd at most 10 times per minute across all the pods:
+
+  klock ratelimit --name some-api --rate 10/m -g -- some_cmd
+
+# Permissions
+
+The execution of klock ratelimit requires the following rule:
+
+  - apiGroups: ["coordination.k8s.io"]
+    resources: ["leases"]
+    verbs: ["create", "get", "update"]
+
+# Exit status
+
+%d if failure.
+The exit status of the given command, if klock executed it.
+128+N if the command was terminated by the signal N, like shells.
+--rejected-exit-code if no token is available.
+
+# Flags
+
+`
+
+func runRateLimit(args []string) {
+	fs := newFlagSet("ratelimit")
+	fs.Usage = func() {
+		fmt.Printf(rateLimitUsage, lease.AnnotationRateLimitTokens+"\n"+lease.AnnotationRateLimitTime, exitCodeFailure)
+		fs.PrintDefaults()
+	}
+	var (
+		kube             = addKubeFlags(fs)
+		name             = fs.String("name", "", "The name of the lease of the token bucket.")
+		burst            = fs.Int("burst", 0, "The capacity of the token bucket. 0 means the count of --rate.")
+		ident            = addIdentityFlags(fs, "client")
+		wait             = fs.DurationP("wait", "w", 0, "Fail if no token is available within the duration. 0 means wait infinitely.")
+		noWait           = fs.Bool("no-wait", false, "If true, fail immediately if no token is available.")
+		rejectedExitCode = fs.Uint8("rejected-exit-code", exitCodeFailure, "The exit status used when no token is available.")
+		onCancel         = addCancelFlags(fs)
+		additionalLabels = addLabelsFlag(fs)
+		rate             lease.Rate
+	)
+	fs.Func("rate", "The rate of the tokens added to the bucket, e.g. 10/m.", func(v string) error {
+		x, err := lease.ParseRate(v)
+		if err != nil {
+			return err
+		}
+		rate = x
+		return nil
+	})
+	err := fs.Parse(args)
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
+
+	ctx := newContext()
+
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to parse flags", err))
+	}
+	cmdArgs, err := commandArgs(fs)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: invalid arguments", err))
+	}
+	identity, err := ident.identity()
+	if err != nil {
+		fail(ctx, err)
+	}
+
+	client, err := kube.newClient(ctx)
+	if err != nil {
+		fail(ctx, err)
+	}
+	limiter, err := lease.NewRateLimiter(
+		*kube.namespace, *name, identity, rate, *burst, client.CoordinationV1(),
+		lease.WithRateLimitLabels(*additionalLabels),
+		lease.WithRateLimitTimeout(*wait),
+		lease.WithRateLimitNoWait(*noWait),
+	)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to create rate limiter", err))
+	}
+
+	proc := process.NewProcess(limiter, cmdArgs[0], cmdArgs[1:]...)
+	proc.Stdin = os.Stdin
+	proc.Stdout = os.Stdout
+	proc.Stderr = os.Stderr
+	onCancel.apply(proc)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop() // in case of panic
+	err = proc.Run(ctx)
+	stop() // release before os.Exit paths in error handling below
+	if err != nil {
+		if errors.Is(err, lease.ErrRateLimited) {
+			failWith(ctx, int(*rejectedExitCode), err)
+		}
+		failCommand(ctx, err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/spf13/pflag"
+)
+
+const statusUsage = `klock status -- display the state of a lease
+
+# Usage
+
+  klock status [flags]
+
+Display the holder of the lease,
+and the result of the last run if recorded by klock --record-last-run.
+
+# Flags
+
+`
+
+func runStatus(args []string) {
+	fs := newFlagSet("status")
+	fs.Usage = func() {
+		fmt.Print(statusUsage)
+		fs.PrintDefaults()
+	}
+	var (
+		kube = addKubeFlags(fs)
+		name = fs.StringP("lease", "l", "klock", "The name of a lease.")
+	)
+	err := fs.Parse(args)
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
+
+	ctx := newContext()
+
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to parse flags", err))
+	}
+	if fs.NArg() > 1 {
+		fail(ctx, fmt.Errorf("%w: %v", errUnexpectedArgs, fs.Args()[1:]))
+	}
+
+	client, err := kube.newClient(ctx)
+	if err != nil {
+		fail(ctx, err)
+	}
+	status, err := lease.GetStatus(ctx, client.CoordinationV1(), *kube.namespace, *name)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to get lease", err))
+	}
+	if err := status.Write(os.Stdout); err != nil {
+		fail(ctx, err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+)
+
+const workUsage = `klock work -- share work items among workers within Kubernetes
+
+# Usage
+
+  klock work --name NAME --items-file FILE [flags] -- command [arguments]
+
+Read the work items from FILE, one per line, and run the command for each item claimed by this worker.
+%[1]s in the command and the arguments is replaced with the item.
+
+Each item is claimed by a lease named NAME-<hash of item>, renewed while the command is running.
+NAME should make the lease names DNS-1123 subdomains, lowercase alphanumerics, '-' or '.'.
+If the worker dies, the claim expires and another worker claims the item again.
+The completion of the item is recorded on the lease NAME-<hash of item>-once, and never claimed again.
+klock work exits when all the items are completed, or failed by this worker.
+
+Use a distinct identity for each worker, e.g. -g.
+
+# Examples
+
+  klock work --name some-job --items-file items.txt -g -- some_cmd {}
+
+# Exit status
+
+0 if all the items are completed.
+%[2]d if any item failed.
+%[3]d if failure of klock itself.
+
+# Flags
+
+`
+
+func runWork(args []string) {
+	fs := newFlagSet("work")
+	fs.Usage = func() {
+		fmt.Printf(workUsage, xargsPlaceholder, exitCodeXargsFailed, exitCodeFailure)
+		fs.PrintDefaults()
+	}
+	var (
+		kube             = addKubeFlags(fs)
+		name             = fs.String("name", "", "The name of the queue, the prefix of the leases.")
+		itemsFile        = fs.String("items-file", "", "The file of the work items, one per line.")
+		ident            = addIdentityFlags(fs, "worker")
+		timing           = addLeaseFlags(fs, "worker", "claim")
+		onCancel         = addCancelFlags(fs)
+		additionalLabels = addLabelsFlag(fs)
+	)
+	err := fs.Parse(args)
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
+
+	ctx := newContext()
+
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to parse flags", err))
+	}
+	cmdArgs, err := commandArgs(fs)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: invalid arguments", err))
+	}
+	f, err := os.Open(*itemsFile)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to open items file", err))
+	}
+	items, err := readItems(f)
+	_ = f.Close()
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to read items", err))
+	}
+	identity, err := ident.identity()
+	if err != nil {
+		fail(ctx, err)
+	}
+	warnDefaultIdentity(ctx, identity)
+
+	client, err := kube.newClient(ctx)
+	if err != nil {
+		fail(ctx, err)
+	}
+	queue, err := lease.NewWorkQueue(
+		*kube.namespace, *name, identity, items, client.CoordinationV1(),
+		append(timing.workQueueOptions(), lease.WithWorkQueueLabels(*additionalLabels))...,
+	)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to create work queue", err))
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = queue.Run(ctx, func(ctx context.Context, item string) error {
+		itemArgs := make([]string, len(cmdArgs))
+		for i, a := range cmdArgs {
+			itemArgs[i] = strings.ReplaceAll(a, xargsPlaceholder, item)
+		}
+		proc := process.NewProcess(&claimedLocker{queue: queue, item: item}, itemArgs[0], itemArgs[1:]...)
+		proc.Stdout = os.Stdout
+		proc.Stderr = os.Stderr
+		onCancel.apply(proc)
+		return proc.Run(ctx)
+	})
+	// stop cancels ctx, so check the signal before it
+	interrupted := ctx.Err() != nil
+	stop()
+	if err != nil {
+		if errors.Is(err, lease.ErrWorkFailed) && !interrupted {
+			failWith(ctx, exitCodeXargsFailed, err)
+		}
+		fail(ctx, err)
+	}
+}
+
+// claimedLocker runs the process for the item already claimed by the queue.
+type claimedLocker struct {
+	queue *lease.WorkQueue
+	item  string
+}
+
+func (l *claimedLocker) LockAndRun(ctx context.Context, f func(context.Context) error) error {
+	return f(ctx)
+}
+
+func (l *claimedLocker) Logger(ctx context.Context) klog.Logger {
+	return l.queue.Logger(ctx).WithValues("item", l.item)
+}
+
+func (l *claimedLocker) String() string {
+	return fmt.Sprintf("%s item=%s", l.queue, l.item)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/berquerant/k8s-lease/logging"
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const xargsUsage = `klock xargs -- run commands for each item with a lock per item within Kubernetes
+
+# Usage
+
+  klock xargs --lease-template TEMPLATE [flags] -- command [arguments]
+
+Read items from stdin, one per line, and run the command for each item
+while holding the lease named by replacing %[1]s in TEMPLATE with the item.
+%[1]s in the command and the arguments is also replaced with the item.
+Different items run in parallel up to -P, but each item is run by only one holder cluster-wide.
+The duplicated items are run once.
+The items making invalid lease names, not DNS-1123 subdomains, are not run and count as failed.
+
+--on-held decides what to do with the items whose leases are held elsewhere:
+
+  wait: wait for the lease, up to --wait
+  skip: skip the item
+
+Use a distinct identity for each worker, e.g. -g.
+
+# Examples
+
+  list_tenants | klock xargs --lease-template 'tenant-{}' -P 4 -g -- some_cmd {}
+
+# Exit status
+
+0 if all the items succeeded or were skipped.
+%[2]d if any item failed.
+%[3]d if failure of klock itself.
+
+# Flags
+
+`
+
+const (
+	xargsPlaceholder = "{}"
+	// exitCodeXargsFailed is the exit status if any item failed, like xargs.
+	exitCodeXargsFailed = 123
+
+	onHeldWait = "wait"
+	onHeldSkip = "skip"
+)
+
+func runXargs(args []string) {
+	fs := newFlagSet("xargs")
+	fs.Usage = func() {
+		fmt.Printf(xargsUsage, xargsPlaceholder, exitCodeXargsFailed, exitCodeFailure)
+		fs.PrintDefaults()
+	}
+	var (
+		kube             = addKubeFlags(fs)
+		leaseTemplate    = fs.String("lease-template", "", "The template of the lease name; {} is replaced with the item.")
+		parallel         = fs.IntP("max-procs", "P", 1, "The number of the items run in parallel.")
+		onHeld           = fs.String("on-held", onHeldWait, "What to do with the items held elsewhere: wait or skip.")
+		wait             = fs.DurationP("wait", "w", 0, "Skip the item if the lock cannot be acquired within the duration with --on-held wait. 0 means wait infinitely.")
+		ident            = addIdentityFlags(fs, "lease holder")
+		cleanupLease     = fs.Bool("cleanup-lease", false, "If true, delete the created leases after processing.")
+		timing           = addLeaseFlags(fs, "leader", "lock")
+		onCancel         = addCancelFlags(fs)
+		additionalLabels = addLabelsFlag(fs)
+	)
+	err := fs.Parse(args)
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
+
+	ctx := newContext()
+
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to parse flags", err))
+	}
+	cmdArgs, err := commandArgs(fs)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: invalid arguments", err))
+	}
+	if !strings.Contains(*leaseTemplate, xargsPlaceholder) {
+		fail(ctx, fmt.Errorf("%w: --lease-template should contain %s", errInvalidFlag, xargsPlaceholder))
+	}
+	if *parallel < 1 {
+		fail(ctx, fmt.Errorf("%w: -P should be positive", errInvalidFlag))
+	}
+	var electTimeout time.Duration
+	switch *onHeld {
+	case onHeldWait:
+		electTimeout = *wait
+	case onHeldSkip:
+		// the first attempt to acquire is made immediately
+		electTimeout = *timing.retryPeriod
+	default:
+		fail(ctx, fmt.Errorf("%w: unknown --on-held: %s", errInvalidFlag, *onHeld))
+	}
+	items, err := readItems(os.Stdin)
+	if err != nil {
+		fail(ctx, fmt.Errorf("%w: failed to read items", err))
+	}
+	identity, err := ident.identity()
+	if err != nil {
+		fail(ctx, err)
+	}
+	warnDefaultIdentity(ctx, identity)
+
+	client, err := kube.newClient(ctx)
+	if err != nil {
+		fail(ctx, err)
+	}
+
+	var (
+		leaseName = func(item string) string {
+			return strings.ReplaceAll(*leaseTemplate, xargsPlaceholder, item)
+		}
+		validItems   []string
+		invalidItems int
+	)
+	for _, item := range items {
+		if errs := validation.IsDNS1123Subdomain(leaseName(item)); len(errs) > 0 {
+			logging.FromContext(ctx).Error(fmt.Errorf("%w: %v", errInvalidLeaseName, errs), "item failed", "item", item, "lease", leaseName(item))
+			invalidItems++
+			continue
+		}
+		validItems = append(validItems, item)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	summary := runItems(ctx, validItems, *parallel, func(ctx context.Context, item string) error {
+		locker, err := lease.NewLocker(
+			*kube.namespace, leaseName(item), identity, client.CoordinationV1(),
+			append(timing.options(),
+				lease.WithLabels(*additionalLabels),
+				lease.WithCleanupLease(*cleanupLease),
+				lease.WithLeaderElectTimeout(electTimeout),
+			)...,
+		)
+		if err != nil {
+			return err
+		}
+		itemArgs := make([]string, len(cmdArgs))
+		for i, a := range cmdArgs {
+			itemArgs[i] = strings.ReplaceAll(a, xargsPlaceholder, item)
+		}
+		proc := process.NewProcess(locker, itemArgs[0], itemArgs[1:]...)
+		proc.Stdout = os.Stdout
+		proc.Stderr = os.Stderr
+		onCancel.apply(proc)
+		return proc.Run(ctx)
+	})
+	stop()
+	summary.failed += invalidItems
+
+	logging.FromContext(ctx).V(0).Info("xargs summary",
+		"items", len(items), "succeeded", summary.succeeded, "failed", summary.failed, "skipped", summary.skipped)
+	if summary.failed > 0 {
+		failWith(ctx, exitCodeXargsFailed, fmt.Errorf("%w: %d items failed", errItemsFailed, summary.failed))
+	}
+}
+
+var (
+	errItemsFailed      = errors.New("ItemsFailed")
+	errInvalidLeaseName = errors.New("InvalidLeaseName")
+)
+
+// readItems reads the non-empty lines without duplicates.
+func readItems(r io.Reader) ([]string, error) {
+	var (
+		items   []string
+		seen    = map[string]bool{}
+		scanner = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		if x := strings.TrimSpace(scanner.Text()); x != "" && !seen[x] {
+			seen[x] = true
+			items = append(items, x)
+		}
+	}
+	return items, scanner.Err()
+}
+
+type xargsSummary struct {
+	succeeded, failed, skipped int
+}
+
+// runItems runs f for each item with the parallelism, until ctx is canceled.
+func runItems(ctx context.Context, items []string, parallel int, f func(ctx context.Context, item string) error) *xargsSummary {
+	var (
+		logger  = logging.FromContext(ctx)
+		summary xargsSummary
+		mux     sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, parallel)
+	)
+	for _, item := range items {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			mux.Lock()
+			summary.skipped++
+			mux.Unlock()
+			continue
+		}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			err := f(ctx, item)
+			mux.Lock()
+			defer mux.Unlock()
+			switch {
+			case err == nil:
+				summary.succeeded++
+			case errors.Is(err, lease.ErrElectTimedOut):
+				logger.V(0).Info("item skipped, held elsewhere", "item", item)
+				summary.skipped++
+			default:
+				logger.Error(err, "item failed", "item", item, "exitCode", lease.ExitCode(err))
+				summary.failed++
+			}
+		})
+	}
+	wg.Wait()
+	return &summary
+}
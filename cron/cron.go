@@ -0,0 +1,216 @@
+// Package cron parses the cron schedule expressions.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("InvalidSchedule")
+
+// Schedule is the parsed cron schedule.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets
+	// domStar and dowStar are true if the field is "*" (or "?"),
+	// used to decide whether a day matches both or either of day of month and day of week.
+	domStar, dowStar bool
+	spec             string
+}
+
+func (s *Schedule) String() string { return s.spec }
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Parse parses the standard 5 fields cron expression: minute, hour, day of month, month and day of week.
+//
+// Each field accepts *, lists (1,2), ranges (1-5), steps (*/5, 1-10/2) and names (jan, mon).
+// Day of week 7 is Sunday as well as 0.
+// The descriptors @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly are also accepted.
+func Parse(spec string) (*Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if x, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = x
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 fields: %q", ErrInvalidSchedule, spec)
+	}
+	s := &Schedule{spec: spec}
+	var err error
+	if s.minute, _, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, _, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, s.domStar, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, _, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, s.dowStar, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // sunday
+	}
+	return s, nil
+}
+
+// parse returns the bit set of the field and true if the field is "*".
+func (f field) parse(expr string) (uint64, bool, error) {
+	if expr == "*" || expr == "?" {
+		return f.bits(f.min, f.max, 1), true, nil
+	}
+	var bits uint64
+	for part := range strings.SplitSeq(expr, ",") {
+		x, err := f.parsePart(part)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w: %s: %q", err, f.name, expr)
+		}
+		bits |= x
+	}
+	return bits, false, nil
+}
+
+func (f field) parsePart(part string) (uint64, error) {
+	rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+	step := 1
+	if hasStep {
+		x, err := strconv.Atoi(stepExpr)
+		if err != nil || x < 1 {
+			return 0, fmt.Errorf("%w: invalid step", ErrInvalidSchedule)
+		}
+		step = x
+	}
+	var lo, hi int
+	switch {
+	case rangeExpr == "*" || rangeExpr == "?":
+		lo, hi = f.min, f.max
+	default:
+		loExpr, hiExpr, isRange := strings.Cut(rangeExpr, "-")
+		var err error
+		if lo, err = f.value(loExpr); err != nil {
+			return 0, err
+		}
+		hi = lo
+		if isRange {
+			if hi, err = f.value(hiExpr); err != nil {
+				return 0, err
+			}
+		} else if hasStep {
+			// like 5/10, from 5 to the end
+			hi = f.max
+		}
+	}
+	if lo > hi {
+		return 0, fmt.Errorf("%w: invalid range", ErrInvalidSchedule)
+	}
+	return f.bits(lo, hi, step), nil
+}
+
+func (f field) value(expr string) (int, error) {
+	if x, ok := f.names[strings.ToLower(expr)]; ok {
+		return x, nil
+	}
+	x, err := strconv.Atoi(expr)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid value", ErrInvalidSchedule)
+	}
+	if x < f.min || x > f.max {
+		return 0, fmt.Errorf("%w: out of range [%d, %d]", ErrInvalidSchedule, f.min, f.max)
+	}
+	return x, nil
+}
+
+func (field) bits(lo, hi, step int) uint64 {
+	var bits uint64
+	for i := lo; i <= hi; i += step {
+		bits |= 1 << uint(i)
+	}
+	return bits
+}
+
+// maxYears bounds the search of Next, for the schedules never matched like Feb 30.
+const maxYears = 5
+
+// Next returns the first scheduled time after t, in the location of t.
+// Returns the zero time if not found.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxYears, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchDay follows the traditional cron:
+// if both day of month and day of week are restricted, either of them matches.
+func (s *Schedule) matchDay(t time.Time) bool {
+	var (
+		dom = s.dom&(1<<uint(t.Day())) != 0
+		dow = s.dow&(1<<uint(t.Weekday())) != 0
+	)
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Between returns the scheduled times in (after, until], up to limit times from the oldest.
+func (s *Schedule) Between(after, until time.Time, limit int) []time.Time {
+	var ts []time.Time
+	for t := s.Next(after); !t.IsZero() && !t.After(until) && len(ts) < limit; t = s.Next(t) {
+		ts = append(ts, t)
+	}
+	return ts
+}
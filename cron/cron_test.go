@@ -0,0 +1,122 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/berquerant/k8s-lease/cron"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		spec  string
+		err   bool
+	}{
+		{title: "every minute", spec: "* * * * *"},
+		{title: "steps", spec: "*/5 1-10/3 * * *"},
+		{title: "names", spec: "0 0 * jan-mar mon,fri"},
+		{title: "descriptor", spec: "@daily"},
+		{title: "sunday as 7", spec: "0 0 * * 7"},
+		{title: "too few fields", spec: "* * * *", err: true},
+		{title: "out of range", spec: "60 * * * *", err: true},
+		{title: "invalid range", spec: "10-5 * * * *", err: true},
+		{title: "invalid step", spec: "*/0 * * * *", err: true},
+		{title: "unknown name", spec: "* * * foo *", err: true},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			_, err := cron.Parse(tc.spec)
+			if tc.err {
+				assert.ErrorIs(t, err, cron.ErrInvalidSchedule)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	for _, tc := range []struct {
+		title string
+		spec  string
+		from  time.Time
+		want  time.Time
+	}{
+		{
+			title: "every 5 minutes",
+			spec:  "*/5 * * * *",
+			from:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			want:  time.Date(2026, 1, 2, 3, 5, 0, 0, time.UTC),
+		},
+		{
+			title: "strictly after",
+			spec:  "*/5 * * * *",
+			from:  time.Date(2026, 1, 2, 3, 5, 0, 0, time.UTC),
+			want:  time.Date(2026, 1, 2, 3, 10, 0, 0, time.UTC),
+		},
+		{
+			title: "next day",
+			spec:  "30 2 * * *",
+			from:  time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 1, 3, 2, 30, 0, 0, time.UTC),
+		},
+		{
+			title: "next year",
+			spec:  "@yearly",
+			from:  time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC),
+			want:  time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			title: "day of week",
+			spec:  "0 9 * * mon",
+			from:  time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), // Sunday
+			want:  time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			title: "day of month or day of week",
+			spec:  "0 0 1 * mon",
+			from:  time.Date(2026, 10, 27, 0, 0, 0, 0, time.UTC), // Tuesday
+			want:  time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			title: "location",
+			spec:  "0 9 * * *",
+			from:  time.Date(2026, 1, 2, 10, 0, 0, 0, jst),
+			want:  time.Date(2026, 1, 3, 9, 0, 0, 0, jst),
+		},
+		{
+			title: "never",
+			spec:  "0 0 30 2 *",
+			from:  time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC),
+			want:  time.Time{},
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			s, err := cron.Parse(tc.spec)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.want, s.Next(tc.from))
+		})
+	}
+}
+
+func TestBetween(t *testing.T) {
+	s, err := cron.Parse("*/10 * * * *")
+	if !assert.Nil(t, err) {
+		return
+	}
+	var (
+		after = time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+		until = time.Date(2026, 1, 2, 3, 30, 0, 0, time.UTC)
+	)
+	assert.Equal(t, []time.Time{
+		time.Date(2026, 1, 2, 3, 10, 0, 0, time.UTC),
+		time.Date(2026, 1, 2, 3, 20, 0, 0, time.UTC),
+		time.Date(2026, 1, 2, 3, 30, 0, 0, time.UTC),
+	}, s.Between(after, until, 10))
+	assert.Len(t, s.Between(after, until, 2), 2)
+	assert.Empty(t, s.Between(after, after.Add(time.Minute), 10))
+}
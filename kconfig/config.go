@@ -1,42 +1,231 @@
 package kconfig
 
 import (
+	"errors"
+	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
-// Build kubeconfig.
-func Build(kubeconfig string) (*rest.Config, error) {
-	if c, err := buildInCluster(); err == nil {
-		return c, nil
+var ErrInvalidInCluster = errors.New("InvalidInCluster")
+
+// InClusterMode decides whether to use the in-cluster config.
+type InClusterMode string
+
+const (
+	// InClusterAuto uses the in-cluster config if running in the cluster,
+	// unless Kubeconfig or Context is given explicitly.
+	InClusterAuto InClusterMode = "auto"
+	// InClusterTrue always uses the in-cluster config.
+	InClusterTrue InClusterMode = "true"
+	// InClusterFalse never uses the in-cluster config.
+	InClusterFalse InClusterMode = "false"
+)
+
+// ParseInClusterMode parses auto, true or false.
+func ParseInClusterMode(v string) (InClusterMode, error) {
+	switch x := InClusterMode(v); x {
+	case InClusterAuto, InClusterTrue, InClusterFalse:
+		return x, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidInCluster, v)
+	}
+}
+
+// Source is the source of the config.
+type Source string
+
+const (
+	SourceInCluster  Source = "in-cluster"
+	SourceKubeconfig Source = "kubeconfig"
+)
+
+// Options is the options to load kubeconfig, like the kubectl flags.
+type Options struct {
+	// InCluster decides whether to use the in-cluster config; empty means InClusterAuto.
+	InCluster InClusterMode
+	// Kubeconfig is the path of kubeconfig.
+	// If empty, the files in $KUBECONFIG separated by the path list separator are merged,
+	// or ~/.kube/config is used.
+	Kubeconfig string
+	// Context is the name of the kubeconfig context to use.
+	Context string
+	// Cluster is the name of the kubeconfig cluster to use.
+	Cluster string
+	// User is the name of the kubeconfig user to use.
+	User string
+	// Impersonate is the username to impersonate.
+	Impersonate string
+	// ImpersonateGroups is the groups to impersonate.
+	ImpersonateGroups []string
+	// Token is the bearer token for authentication.
+	Token string
+	// Server is the address of the API server.
+	Server string
+	// QPS is the maximum queries per second to the API server; 0 means the client-go default.
+	QPS float32
+	// Burst is the maximum burst of the queries to the API server; 0 means the client-go default.
+	Burst int
+	// Timeout is the time limit of each request; 0 means no limit.
+	Timeout time.Duration
+	// UserAgent is the user agent of the requests; empty means the client-go default.
+	UserAgent string
+}
+
+// contentTypeProtobuf is preferred to JSON for the built-in resources such as leases.
+const contentTypeProtobuf = "application/vnd.kubernetes.protobuf"
+
+// tune applies the client settings to c.
+func (o *Options) tune(c *rest.Config) *rest.Config {
+	if o.QPS > 0 {
+		c.QPS = o.QPS
+	}
+	if o.Burst > 0 {
+		c.Burst = o.Burst
+	}
+	if o.Timeout > 0 {
+		c.Timeout = o.Timeout
+	}
+	if o.UserAgent != "" {
+		c.UserAgent = o.UserAgent
+	}
+	c.ContentType = contentTypeProtobuf
+	c.AcceptContentTypes = contentTypeProtobuf + ",application/json"
+	return c
+}
+
+func (o *Options) loadingRules() *clientcmd.ClientConfigLoadingRules {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.Kubeconfig
+	return rules
+}
+
+func (o *Options) overrides() *clientcmd.ConfigOverrides {
+	return &clientcmd.ConfigOverrides{
+		CurrentContext: o.Context,
+		Context: clientcmdapi.Context{
+			Cluster:  o.Cluster,
+			AuthInfo: o.User,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			Token:             o.Token,
+			Impersonate:       o.Impersonate,
+			ImpersonateGroups: o.ImpersonateGroups,
+		},
+		ClusterInfo: clientcmdapi.Cluster{
+			Server: o.Server,
+		},
+	}
+}
+
+func (o *Options) clientConfig() clientcmd.ClientConfig {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(o.loadingRules(), o.overrides())
+}
+
+// Source returns the source of the config to use.
+func (o *Options) Source() (Source, error) {
+	switch o.InCluster {
+	case InClusterTrue:
+		if !InCluster() {
+			return "", fmt.Errorf("%w: not running in the cluster", ErrInvalidInCluster)
+		}
+		return SourceInCluster, nil
+	case InClusterFalse:
+		return SourceKubeconfig, nil
+	case InClusterAuto, "":
+		if o.Kubeconfig == "" && o.Context == "" && InCluster() {
+			return SourceInCluster, nil
+		}
+		return SourceKubeconfig, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidInCluster, o.InCluster)
 	}
-	return build(selectPath(kubeconfig))
 }
 
-func buildInCluster() (*rest.Config, error) {
-	return rest.InClusterConfig()
+// CurrentContext returns the name of the kubeconfig context to use.
+func (o *Options) CurrentContext() string {
+	if o.Context != "" {
+		return o.Context
+	}
+	raw, err := o.clientConfig().RawConfig()
+	if err != nil {
+		return ""
+	}
+	return raw.CurrentContext
 }
 
-func build(kubeconfig string) (*rest.Config, error) {
-	c, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// Build kubeconfig from the source given by Options.Source, with the client settings of o.
+// The clients built from it request protobuf.
+func Build(o *Options) (*rest.Config, Source, error) {
+	source, err := o.Source()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return c, nil
+	var c *rest.Config
+	if source == SourceInCluster {
+		c, err = buildInCluster(o)
+	} else {
+		c, err = o.clientConfig().ClientConfig()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return o.tune(c), source, nil
 }
 
-func selectPath(kubeconfig string) string {
-	if x := kubeconfig; x != "" {
-		return x
+// DefaultNamespace is the namespace used if no namespace is configured.
+const DefaultNamespace = "default"
+
+// serviceAccountNamespacePath is the file of the namespace of the pod.
+var serviceAccountNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Namespace returns the namespace used when not given explicitly:
+// the namespace of the service account if the source is in-cluster,
+// otherwise the namespace of the current context of kubeconfig, or DefaultNamespace.
+func Namespace(o *Options) string {
+	if source, _ := o.Source(); source == SourceInCluster {
+		if b, err := os.ReadFile(serviceAccountNamespacePath); err == nil {
+			if x := strings.TrimSpace(string(b)); x != "" {
+				return x
+			}
+		}
 	}
-	if x := os.Getenv("KUBECONFIG"); x != "" {
+	if x, _, err := o.clientConfig().Namespace(); err == nil && x != "" {
 		return x
 	}
-	if d, err := os.UserHomeDir(); err == nil {
-		return filepath.Join(d, ".kube", "config")
+	return DefaultNamespace
+}
+
+// inClusterConfig returns the config of the service account of the pod.
+var inClusterConfig = rest.InClusterConfig
+
+// InCluster returns true if running in the cluster.
+func InCluster() bool {
+	_, err := inClusterConfig()
+	return err == nil
+}
+
+// buildInCluster returns the in-cluster config with the server, the token and the impersonation of o.
+func buildInCluster(o *Options) (*rest.Config, error) {
+	c, err := inClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	if o.Server != "" {
+		c.Host = o.Server
 	}
-	return ""
+	if o.Token != "" {
+		c.BearerToken = o.Token
+		c.BearerTokenFile = ""
+	}
+	c.Impersonate = rest.ImpersonationConfig{
+		UserName: o.Impersonate,
+		Groups:   o.ImpersonateGroups,
+	}
+	return c, nil
 }
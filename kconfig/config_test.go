@@ -0,0 +1,397 @@
+package kconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/berquerant/k8s-lease/kconfig"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: ctx
+contexts:
+- name: ctx
+  context:
+    cluster: c
+    user: u
+    namespace: team-a
+- name: nons
+  context:
+    cluster: c
+    user: u
+clusters:
+- name: c
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: u
+  user:
+    token: "x"
+`
+
+// writeFile writes the content to the file in the temporary directory and returns the path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var inClusterConfig = &rest.Config{
+	Host:            "https://10.0.0.1:443",
+	BearerTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+}
+
+func TestSource(t *testing.T) {
+	for _, tc := range []struct {
+		title     string
+		opt       kconfig.Options
+		inCluster bool
+		want      kconfig.Source
+		err       error
+	}{
+		{
+			title: "auto outside the cluster",
+			want:  kconfig.SourceKubeconfig,
+		},
+		{
+			title:     "auto in the cluster",
+			inCluster: true,
+			want:      kconfig.SourceInCluster,
+		},
+		{
+			title: "auto in the cluster with kubeconfig",
+			opt: kconfig.Options{
+				Kubeconfig: "kubeconfig",
+			},
+			inCluster: true,
+			want:      kconfig.SourceKubeconfig,
+		},
+		{
+			title: "auto in the cluster with context",
+			opt: kconfig.Options{
+				Context: "ctx",
+			},
+			inCluster: true,
+			want:      kconfig.SourceKubeconfig,
+		},
+		{
+			title: "true in the cluster",
+			opt: kconfig.Options{
+				InCluster: kconfig.InClusterTrue,
+				Context:   "ctx",
+			},
+			inCluster: true,
+			want:      kconfig.SourceInCluster,
+		},
+		{
+			title: "true outside the cluster",
+			opt: kconfig.Options{
+				InCluster: kconfig.InClusterTrue,
+			},
+			err: kconfig.ErrInvalidInCluster,
+		},
+		{
+			title: "false in the cluster",
+			opt: kconfig.Options{
+				InCluster: kconfig.InClusterFalse,
+			},
+			inCluster: true,
+			want:      kconfig.SourceKubeconfig,
+		},
+		{
+			title: "unknown mode",
+			opt: kconfig.Options{
+				InCluster: "unknown",
+			},
+			err: kconfig.ErrInvalidInCluster,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			if tc.inCluster {
+				kconfig.FakeInCluster(t, inClusterConfig, "")
+			} else {
+				kconfig.FakeInCluster(t, nil, "")
+			}
+			got, err := tc.opt.Source()
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	var (
+		kubeconfig     = writeFile(t, "config", testKubeconfig)
+		saNamespace    = writeFile(t, "namespace", "team-sa\n")
+		emptyNamespace = writeFile(t, "empty", "")
+	)
+	for _, tc := range []struct {
+		title       string
+		opt         kconfig.Options
+		inCluster   bool
+		saNamespace string
+		want        string
+	}{
+		{
+			title: "current context",
+			opt: kconfig.Options{
+				Kubeconfig: kubeconfig,
+			},
+			want: "team-a",
+		},
+		{
+			title: "context without namespace",
+			opt: kconfig.Options{
+				Kubeconfig: kubeconfig,
+				Context:    "nons",
+			},
+			want: kconfig.DefaultNamespace,
+		},
+		{
+			title: "kubeconfig not found",
+			opt: kconfig.Options{
+				Kubeconfig: filepath.Join(t.TempDir(), "notfound"),
+			},
+			want: kconfig.DefaultNamespace,
+		},
+		{
+			title:       "service account",
+			inCluster:   true,
+			saNamespace: saNamespace,
+			want:        "team-sa",
+		},
+		{
+			title:       "empty service account namespace",
+			inCluster:   true,
+			saNamespace: emptyNamespace,
+			want:        kconfig.DefaultNamespace,
+		},
+		{
+			title:       "service account namespace not found",
+			inCluster:   true,
+			saNamespace: filepath.Join(t.TempDir(), "notfound"),
+			want:        kconfig.DefaultNamespace,
+		},
+		{
+			title: "kubeconfig in the cluster",
+			opt: kconfig.Options{
+				Kubeconfig: kubeconfig,
+			},
+			inCluster:   true,
+			saNamespace: saNamespace,
+			want:        "team-a",
+		},
+		{
+			title: "service account outside the cluster",
+			opt: kconfig.Options{
+				Kubeconfig: kubeconfig,
+				Context:    "nons",
+			},
+			saNamespace: saNamespace,
+			want:        kconfig.DefaultNamespace,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			// isolate from the kubeconfig of the environment
+			t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "notfound"))
+			if tc.inCluster {
+				kconfig.FakeInCluster(t, inClusterConfig, tc.saNamespace)
+			} else {
+				kconfig.FakeInCluster(t, nil, tc.saNamespace)
+			}
+			assert.Equal(t, tc.want, kconfig.Namespace(&tc.opt))
+		})
+	}
+}
+
+const testKubeconfig2 = `apiVersion: v1
+kind: Config
+current-context: ctx2
+contexts:
+- name: ctx2
+  context:
+    cluster: c2
+    user: u2
+    namespace: team-b
+clusters:
+- name: c2
+  cluster:
+    server: https://127.0.0.2:6443
+users:
+- name: u2
+  user:
+    token: "y"
+`
+
+func TestKubeconfig(t *testing.T) {
+	var (
+		kubeconfig  = writeFile(t, "config", testKubeconfig)
+		kubeconfig2 = writeFile(t, "config2", testKubeconfig2)
+		merged      = kubeconfig + string(filepath.ListSeparator) + kubeconfig2
+	)
+	for _, tc := range []struct {
+		title     string
+		env       string
+		opt       kconfig.Options
+		context   string
+		host      string
+		token     string
+		namespace string
+	}{
+		{
+			title:     "merged",
+			env:       merged,
+			context:   "ctx",
+			host:      "https://127.0.0.1:6443",
+			token:     "x",
+			namespace: "team-a",
+		},
+		{
+			title: "context in the second file",
+			env:   merged,
+			opt: kconfig.Options{
+				Context: "ctx2",
+			},
+			context:   "ctx2",
+			host:      "https://127.0.0.2:6443",
+			token:     "y",
+			namespace: "team-b",
+		},
+		{
+			title: "cluster override",
+			env:   merged,
+			opt: kconfig.Options{
+				Cluster: "c2",
+			},
+			context:   "ctx",
+			host:      "https://127.0.0.2:6443",
+			token:     "x",
+			namespace: "team-a",
+		},
+		{
+			title: "user override",
+			env:   merged,
+			opt: kconfig.Options{
+				User: "u2",
+			},
+			context:   "ctx",
+			host:      "https://127.0.0.1:6443",
+			token:     "y",
+			namespace: "team-a",
+		},
+		{
+			title: "explicit kubeconfig",
+			env:   merged,
+			opt: kconfig.Options{
+				Kubeconfig: kubeconfig2,
+			},
+			context:   "ctx2",
+			host:      "https://127.0.0.2:6443",
+			token:     "y",
+			namespace: "team-b",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", tc.env)
+			kconfig.FakeInCluster(t, nil, "")
+			assert.Equal(t, tc.context, tc.opt.CurrentContext())
+			assert.Equal(t, tc.namespace, kconfig.Namespace(&tc.opt))
+			c, source, err := kconfig.Build(&tc.opt)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, kconfig.SourceKubeconfig, source)
+			assert.Equal(t, tc.host, c.Host)
+			assert.Equal(t, tc.token, c.BearerToken)
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	kubeconfig := writeFile(t, "config", testKubeconfig)
+	for _, tc := range []struct {
+		title     string
+		opt       kconfig.Options
+		inCluster bool
+		source    kconfig.Source
+		host      string
+		qps       float32
+		burst     int
+		timeout   time.Duration
+		userAgent string
+	}{
+		{
+			title: "defaults",
+			opt: kconfig.Options{
+				Kubeconfig: kubeconfig,
+			},
+			source: kconfig.SourceKubeconfig,
+			host:   "https://127.0.0.1:6443",
+		},
+		{
+			title: "client settings",
+			opt: kconfig.Options{
+				Kubeconfig: kubeconfig,
+				QPS:        20,
+				Burst:      40,
+				Timeout:    30 * time.Second,
+				UserAgent:  "klock-test",
+			},
+			source:    kconfig.SourceKubeconfig,
+			host:      "https://127.0.0.1:6443",
+			qps:       20,
+			burst:     40,
+			timeout:   30 * time.Second,
+			userAgent: "klock-test",
+		},
+		{
+			title: "client settings in the cluster",
+			opt: kconfig.Options{
+				QPS:       20,
+				Burst:     40,
+				Timeout:   30 * time.Second,
+				UserAgent: "klock-test",
+			},
+			inCluster: true,
+			source:    kconfig.SourceInCluster,
+			host:      inClusterConfig.Host,
+			qps:       20,
+			burst:     40,
+			timeout:   30 * time.Second,
+			userAgent: "klock-test",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "notfound"))
+			if tc.inCluster {
+				kconfig.FakeInCluster(t, inClusterConfig, "")
+			} else {
+				kconfig.FakeInCluster(t, nil, "")
+			}
+			c, source, err := kconfig.Build(&tc.opt)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.source, source)
+			assert.Equal(t, tc.host, c.Host)
+			assert.Equal(t, tc.qps, c.QPS)
+			assert.Equal(t, tc.burst, c.Burst)
+			assert.Equal(t, tc.timeout, c.Timeout)
+			assert.Equal(t, tc.userAgent, c.UserAgent)
+			assert.Equal(t, "application/vnd.kubernetes.protobuf", c.ContentType)
+			assert.Equal(t, "application/vnd.kubernetes.protobuf,application/json", c.AcceptContentTypes)
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package kconfig
+
+import (
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+// FakeInCluster pretends to run in the cluster with the namespace file of the service account
+// until the end of the test.
+// If c is nil, pretends to run outside the cluster.
+func FakeInCluster(t *testing.T, c *rest.Config, namespacePath string) {
+	t.Helper()
+	origConfig, origPath := inClusterConfig, serviceAccountNamespacePath
+	t.Cleanup(func() {
+		inClusterConfig, serviceAccountNamespacePath = origConfig, origPath
+	})
+	inClusterConfig = func() (*rest.Config, error) {
+		if c == nil {
+			return nil, rest.ErrNotInCluster
+		}
+		return rest.CopyConfig(c), nil
+	}
+	serviceAccountNamespacePath = namespacePath
+}
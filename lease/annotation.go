@@ -0,0 +1,88 @@
+package lease
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+const annotationPrefix = "k8s-lease.berquerant.github.com/"
+
+// Annotations of the last run recorded by WithRecordLastRun.
+const (
+	AnnotationLastRunStart    = annotationPrefix + "last-run-start"
+	AnnotationLastRunEnd      = annotationPrefix + "last-run-end"
+	AnnotationLastExitCode    = annotationPrefix + "last-exit-code"
+	AnnotationLastHolder      = annotationPrefix + "last-holder"
+	AnnotationLastSuccessTime = annotationPrefix + "last-success-time"
+)
+
+// AnnotationScheduledTime is the last scheduled time run by WithScheduledTime.
+const AnnotationScheduledTime = annotationPrefix + "scheduled-time"
+
+// AnnotationReentrantDepth is the number of the nested holders reentering the lease, see WithReentrant.
+const AnnotationReentrantDepth = annotationPrefix + "reentrant-depth"
+
+// AnnotationHolderNonce is the nonce of the process holding the lease,
+// to detect the processes with the same identity.
+const AnnotationHolderNonce = annotationPrefix + "holder-nonce"
+
+// AnnotationShardKey is the key locking the shard, see NewShardedLocker.
+const AnnotationShardKey = annotationPrefix + "shard-key"
+
+// ExitCode returns the exit status corresponding to the error returned by the function of LockAndRun.
+//
+// 0 if err is nil, the result of ExitCode() if err has such a method (e.g. *exec.ExitError), 1 otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var x interface{ ExitCode() int }
+	if errors.As(err, &x) {
+		return x.ExitCode()
+	}
+	return 1
+}
+
+// LastRun is the result of the last run recorded on the lease.
+type LastRun struct {
+	StartTime time.Time
+	EndTime   time.Time
+	ExitCode  int
+	Holder    string
+	// SuccessTime is the end time of the last successful run; zero if never succeeded.
+	SuccessTime time.Time
+}
+
+func (r *LastRun) intoAnnotations() map[string]string {
+	a := map[string]string{
+		AnnotationLastRunStart: r.StartTime.Format(time.RFC3339),
+		AnnotationLastRunEnd:   r.EndTime.Format(time.RFC3339),
+		AnnotationLastExitCode: strconv.Itoa(r.ExitCode),
+		AnnotationLastHolder:   r.Holder,
+	}
+	if !r.SuccessTime.IsZero() {
+		a[AnnotationLastSuccessTime] = r.SuccessTime.Format(time.RFC3339)
+	}
+	return a
+}
+
+// lastRunFromAnnotations returns nil if no runs are recorded.
+func lastRunFromAnnotations(a map[string]string) *LastRun {
+	if _, ok := a[AnnotationLastRunStart]; !ok {
+		return nil
+	}
+	var (
+		r         LastRun
+		parseTime = func(key string) time.Time {
+			t, _ := time.Parse(time.RFC3339, a[key])
+			return t
+		}
+	)
+	r.StartTime = parseTime(AnnotationLastRunStart)
+	r.EndTime = parseTime(AnnotationLastRunEnd)
+	r.ExitCode, _ = strconv.Atoi(a[AnnotationLastExitCode])
+	r.Holder = a[AnnotationLastHolder]
+	r.SuccessTime = parseTime(AnnotationLastSuccessTime)
+	return &r
+}
@@ -0,0 +1,440 @@
+package lease
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/berquerant/k8s-lease/logging"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+var (
+	ErrInvalidBarrier  = errors.New("InvalidBarrier")
+	ErrBarrierTimedOut = errors.New("BarrierTimedOut")
+)
+
+const (
+	// LabelBarrier is the label of the leases of the barrier participants; the value is the name of the barrier.
+	LabelBarrier = annotationPrefix + "barrier"
+	// AnnotationBarrierReleased is set on the lease of the participant that has passed the barrier.
+	AnnotationBarrierReleased = annotationPrefix + "barrier-released"
+	// AnnotationBarrierGeneration is the generation of the barrier the participant has arrived at.
+	AnnotationBarrierGeneration = annotationPrefix + "barrier-generation"
+)
+
+//go:generate go tool goconfig -field "BarrierLabels labels.Set|BarrierCleanupLease bool|BarrierLeaseDuration time.Duration|BarrierRetryPeriod time.Duration|BarrierTimeout time.Duration" -option -prefix Barrier -output barrier_config_generated.go
+
+// NewBarrier creates the new Barrier instance.
+//
+//   - namespace: the namespace of the leases
+//   - name: the name of the barrier
+//   - id: the id of the participant
+//   - parties: the number of the participants to wait for
+//   - client: the leases client
+//
+// Available options:
+//
+//   - WithBarrierLabels: the additional labels of the leases
+//   - WithBarrierCleanupLease: if true, delete the lease of the participant after all the participants have passed (default: false)
+//   - WithBarrierLeaseDuration: the duration of the lease of the participant, renewed while waiting (default: 15 seconds)
+//   - WithBarrierRetryPeriod: the time interval between each check of the arrivals (default: 2 seconds)
+//   - WithBarrierTimeout: the timeout of waiting for the participants (default: unlimited(0))
+func NewBarrier(
+	namespace, name, id string,
+	parties int,
+	client coordinationv1client.LeasesGetter,
+	opt ...BarrierConfigOption,
+) (*Barrier, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("%w: namespace is empty", ErrInvalidBarrier)
+	}
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: invalid name %q: %v", ErrInvalidBarrier, name, errs)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is empty", ErrInvalidBarrier)
+	}
+	if parties < 1 {
+		return nil, fmt.Errorf("%w: parties should be positive: %d", ErrInvalidBarrier, parties)
+	}
+	if client == nil {
+		return nil, fmt.Errorf("%w: client is nil", ErrInvalidBarrier)
+	}
+	config := NewBarrierConfigBuilder().
+		BarrierLabels(nil).
+		BarrierCleanupLease(false).
+		BarrierLeaseDuration(DefaultLeaseDuration).
+		BarrierRetryPeriod(DefaultRetryPeriod).
+		BarrierTimeout(0).
+		Build()
+	for _, f := range opt {
+		f(config)
+	}
+	if config.BarrierRetryPeriod.Get() <= 0 {
+		return nil, fmt.Errorf("%w: retry period should be positive", ErrInvalidBarrier)
+	}
+	if config.BarrierLeaseDuration.Get() <= config.BarrierRetryPeriod.Get() {
+		return nil, fmt.Errorf("%w: lease duration should be greater than retry period", ErrInvalidBarrier)
+	}
+	return &Barrier{
+		namespace:     namespace,
+		name:          name,
+		id:            id,
+		parties:       parties,
+		client:        client,
+		labels:        config.BarrierLabels.Get(),
+		needCleanup:   config.BarrierCleanupLease.Get(),
+		leaseDuration: config.BarrierLeaseDuration.Get(),
+		retryPeriod:   config.BarrierRetryPeriod.Get(),
+		timeout:       config.BarrierTimeout.Get(),
+	}, nil
+}
+
+// Barrier blocks the participants until the given number of them have arrived.
+//
+// Each participant registers itself by the lease named `<name>-<hash of id>` labelled with LabelBarrier,
+// and renews it while waiting; the expired leases are not counted.
+// The participants are released once the number of the leases reaches the parties,
+// or any participant has been released.
+//
+// The leases are annotated with AnnotationBarrierGeneration.
+// Once any participant has been released, the later participants arrive at the next generation,
+// so the remaining leases do not release them.
+type Barrier struct {
+	namespace                           string
+	name                                string
+	id                                  string
+	parties                             int
+	client                              coordinationv1client.LeasesGetter
+	labels                              labels.Set
+	needCleanup                         bool
+	leaseDuration, retryPeriod, timeout time.Duration
+	// generation is the generation of the barrier the participant has arrived at.
+	generation int
+}
+
+func (b *Barrier) String() string {
+	return fmt.Sprintf("namespace=%s barrier=%s id=%s parties=%d", b.namespace, b.name, b.id, b.parties)
+}
+
+func (b *Barrier) Logger(ctx context.Context) klog.Logger {
+	return logging.FromContext(ctx).WithValues(
+		"namespace", b.namespace,
+		"barrier", b.name,
+		"id", b.id,
+	)
+}
+
+func (b *Barrier) Labels() labels.Set {
+	return labels.Merge(labels.Merge(b.labels, CommonLabels()), labels.Set{
+		LabelBarrier: b.name,
+	})
+}
+
+// leaseName returns the name of the lease of the participant.
+func (b *Barrier) leaseName() string {
+	sum := sha256.Sum256([]byte(b.id))
+	return fmt.Sprintf("%s-%x", b.name, sum[:5])
+}
+
+// Wait registers the participant and blocks until the parties have arrived.
+//
+// Do the following:
+//
+//   - create the lease of the participant in the current generation
+//   - renew the lease until return
+//   - abort if the participants do not arrive within the timeout
+//   - mark the participant as released, or withdraw it by expiring the lease if aborted
+//   - delete the lease if needed, after all the participants have been released
+func (b *Barrier) Wait(ctx context.Context) error {
+	parentCtx := ctx // keep a reference before WithTimeout for use in cleanup
+	logger := b.Logger(ctx)
+
+	var cancel context.CancelFunc
+	if b.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	if err := b.register(ctx); err != nil {
+		return fmt.Errorf("%w: failed to register: %s", err, b)
+	}
+	logger = logger.WithValues("generation", b.generation)
+	logger.V(1).Info("arrived at the barrier")
+
+	renewCtx, stopRenew := context.WithCancel(parentCtx)
+	defer stopRenew()
+	go b.renew(renewCtx, logger)
+
+	var errs []error
+	err := b.await(ctx, logger)
+	switch {
+	case err == nil:
+		logger.V(0).Info("passed the barrier")
+		if err := b.release(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%w: failed to mark released: %s", err, b))
+		}
+	case errors.Is(err, context.DeadlineExceeded) && parentCtx.Err() == nil:
+		logger.V(0).Info("aborting because the barrier timed out")
+		errs = append(errs, ErrBarrierTimedOut)
+	default:
+		errs = append(errs, err)
+	}
+
+	if err != nil && !b.needCleanup {
+		stopRenew()
+		if err := b.withdraw(parentCtx); err != nil {
+			errs = append(errs, fmt.Errorf("%w: failed to withdraw: %s", err, b))
+		}
+	}
+	if b.needCleanup {
+		logger.V(1).Info("cleanup lease")
+		if err := b.cleanup(parentCtx, err == nil); err != nil {
+			errs = append(errs, fmt.Errorf("%w: failed to cleanup lease: %s", err, b))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// register creates the lease of the participant, or refreshes it if arrived again, e.g. restarted.
+func (b *Barrier) register(ctx context.Context) error {
+	c := b.client.Leases(b.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		list, err := b.list(ctx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		b.generation = b.currentGeneration(list.Items, now)
+		x, err := c.Get(ctx, b.leaseName(), metav1.GetOptions{})
+		switch {
+		case k8serrors.IsNotFound(err):
+			x = &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: b.namespace,
+					Name:      b.leaseName(),
+				},
+			}
+			b.setRegistration(x, now)
+			_, err = c.Create(ctx, x, metav1.CreateOptions{})
+			if k8serrors.IsAlreadyExists(err) {
+				// registered concurrently by the same id, try again as an update
+				return k8serrors.NewConflict(coordinationv1.Resource("leases"), b.leaseName(), err)
+			}
+			return err
+		case err != nil:
+			return err
+		default:
+			x = x.DeepCopy()
+			b.setRegistration(x, now)
+			_, err = c.Update(ctx, x, metav1.UpdateOptions{})
+			return err
+		}
+	})
+}
+
+// setRegistration overwrites the lease with the arrival of the participant at the generation.
+func (b *Barrier) setRegistration(x *coordinationv1.Lease, now time.Time) {
+	t := metav1.NewMicroTime(now)
+	x.Labels = b.Labels()
+	x.Annotations = map[string]string{
+		AnnotationBarrierGeneration: strconv.Itoa(b.generation),
+	}
+	x.Spec = coordinationv1.LeaseSpec{
+		HolderIdentity:       &b.id,
+		LeaseDurationSeconds: new(int32(b.leaseDuration.Seconds())),
+		AcquireTime:          &t,
+		RenewTime:            &t,
+	}
+}
+
+// currentGeneration returns the latest generation of the unexpired leases of the other participants,
+// or the next one if it has been released.
+func (b *Barrier) currentGeneration(xs []coordinationv1.Lease, now time.Time) int {
+	var (
+		generation int
+		released   bool
+	)
+	for _, x := range xs {
+		if x.Name == b.leaseName() || expired(&x, now) {
+			continue
+		}
+		g := barrierGeneration(&x)
+		_, r := x.GetAnnotations()[AnnotationBarrierReleased]
+		switch {
+		case g > generation:
+			generation, released = g, r
+		case g == generation:
+			released = released || r
+		}
+	}
+	if released {
+		return generation + 1
+	}
+	return generation
+}
+
+func barrierGeneration(x *coordinationv1.Lease) int {
+	v, _ := strconv.Atoi(x.GetAnnotations()[AnnotationBarrierGeneration])
+	return max(v, 0)
+}
+
+// renew updates the renew time of the lease of the participant every retry period.
+func (b *Barrier) renew(ctx context.Context, logger klog.Logger) {
+	ticker := time.NewTicker(b.retryPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := b.update(ctx, func(x *coordinationv1.Lease) {
+			x.Spec.RenewTime = new(metav1.NewMicroTime(time.Now()))
+		}); err != nil {
+			logger.V(1).Info("failed to renew the lease", "err", err)
+		}
+	}
+}
+
+// update modifies the lease of the participant by f.
+func (b *Barrier) update(ctx context.Context, f func(*coordinationv1.Lease)) error {
+	c := b.client.Leases(b.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		x, err := c.Get(ctx, b.leaseName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		x = x.DeepCopy()
+		f(x)
+		_, err = c.Update(ctx, x, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (b *Barrier) list(ctx context.Context) (*coordinationv1.LeaseList, error) {
+	return b.client.Leases(b.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{LabelBarrier: b.name}.String(),
+	})
+}
+
+type barrierState struct {
+	arrived  int
+	released int
+}
+
+// state counts the unexpired leases in the generation of the participant.
+func (b *Barrier) state(ctx context.Context) (*barrierState, error) {
+	list, err := b.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		s   barrierState
+		now = time.Now()
+	)
+	for _, x := range list.Items {
+		if barrierGeneration(&x) != b.generation || expired(&x, now) {
+			continue
+		}
+		s.arrived++
+		if _, ok := x.GetAnnotations()[AnnotationBarrierReleased]; ok {
+			s.released++
+		}
+	}
+	return &s, nil
+}
+
+// await blocks until the parties have arrived or any participant has been released.
+func (b *Barrier) await(ctx context.Context, logger klog.Logger) error {
+	ticker := time.NewTicker(b.retryPeriod)
+	defer ticker.Stop()
+	for {
+		s, err := b.state(ctx)
+		switch {
+		case err != nil:
+			logger.V(1).Info("failed to get the arrivals", "err", err)
+		case s.arrived >= b.parties || s.released > 0:
+			return nil
+		default:
+			logger.V(1).Info("waiting the participants", "arrived", s.arrived, "parties", b.parties)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// release marks the participant as released so that the slower participants can pass
+// even if the leases of the others have been deleted.
+func (b *Barrier) release(ctx context.Context) error {
+	return b.update(ctx, func(x *coordinationv1.Lease) {
+		if x.Annotations == nil {
+			x.Annotations = map[string]string{}
+		}
+		x.Annotations[AnnotationBarrierReleased] = time.Now().Format(time.RFC3339)
+		x.Spec.RenewTime = new(metav1.NewMicroTime(time.Now()))
+	})
+}
+
+// withdraw expires the lease of the participant so that it is no longer counted.
+func (b *Barrier) withdraw(parentCtx context.Context) error {
+	ctx, cancel := context.WithTimeout(parentCtx, cleanupTimeout)
+	defer cancel()
+	return b.update(ctx, func(x *coordinationv1.Lease) {
+		x.Spec.RenewTime = nil
+	})
+}
+
+// cleanup deletes the lease of the participant.
+// If passed, wait for all the remaining participants to be released before deletion,
+// otherwise the slower participants could not see the arrivals.
+func (b *Barrier) cleanup(parentCtx context.Context, passed bool) error {
+	ctx, cancel := context.WithTimeout(parentCtx, cleanupTimeout+b.retryPeriod)
+	defer cancel()
+	if passed {
+		ticker := time.NewTicker(b.retryPeriod)
+		defer ticker.Stop()
+		for {
+			s, err := b.state(ctx)
+			if err != nil {
+				return err
+			}
+			if s.released >= s.arrived {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w: waiting the participants to be released", ctx.Err())
+			case <-ticker.C:
+			}
+		}
+	}
+	c := b.client.Leases(b.namespace)
+	x, err := c.Get(ctx, b.leaseName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, b.leaseName(), metav1.DeleteOptions{
+		PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+		Preconditions: &metav1.Preconditions{
+			UID: new(x.GetUID()),
+		},
+	})
+}
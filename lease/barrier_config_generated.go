@@ -0,0 +1,117 @@
+// Code generated by "goconfig -field BarrierLabels labels.Set|BarrierCleanupLease bool|BarrierLeaseDuration time.Duration|BarrierRetryPeriod time.Duration|BarrierTimeout time.Duration -option -prefix Barrier -output barrier_config_generated.go"; DO NOT EDIT.
+
+package lease
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type BarrierConfigItem[T any] struct {
+	modified     bool
+	value        T
+	defaultValue T
+}
+
+func (s *BarrierConfigItem[T]) Set(value T) {
+	s.modified = true
+	s.value = value
+}
+func (s *BarrierConfigItem[T]) Get() T {
+	if s.modified {
+		return s.value
+	}
+	return s.defaultValue
+}
+func (s *BarrierConfigItem[T]) Default() T {
+	return s.defaultValue
+}
+func (s *BarrierConfigItem[T]) IsModified() bool {
+	return s.modified
+}
+func NewBarrierConfigItem[T any](defaultValue T) *BarrierConfigItem[T] {
+	return &BarrierConfigItem[T]{
+		defaultValue: defaultValue,
+	}
+}
+
+type BarrierConfig struct {
+	BarrierLabels        *BarrierConfigItem[labels.Set]
+	BarrierCleanupLease  *BarrierConfigItem[bool]
+	BarrierLeaseDuration *BarrierConfigItem[time.Duration]
+	BarrierRetryPeriod   *BarrierConfigItem[time.Duration]
+	BarrierTimeout       *BarrierConfigItem[time.Duration]
+}
+type BarrierConfigBuilder struct {
+	barrierLabels        labels.Set
+	barrierCleanupLease  bool
+	barrierLeaseDuration time.Duration
+	barrierRetryPeriod   time.Duration
+	barrierTimeout       time.Duration
+}
+
+func (s *BarrierConfigBuilder) BarrierLabels(v labels.Set) *BarrierConfigBuilder {
+	s.barrierLabels = v
+	return s
+}
+func (s *BarrierConfigBuilder) BarrierCleanupLease(v bool) *BarrierConfigBuilder {
+	s.barrierCleanupLease = v
+	return s
+}
+func (s *BarrierConfigBuilder) BarrierLeaseDuration(v time.Duration) *BarrierConfigBuilder {
+	s.barrierLeaseDuration = v
+	return s
+}
+func (s *BarrierConfigBuilder) BarrierRetryPeriod(v time.Duration) *BarrierConfigBuilder {
+	s.barrierRetryPeriod = v
+	return s
+}
+func (s *BarrierConfigBuilder) BarrierTimeout(v time.Duration) *BarrierConfigBuilder {
+	s.barrierTimeout = v
+	return s
+}
+func (s *BarrierConfigBuilder) Build() *BarrierConfig {
+	return &BarrierConfig{
+		BarrierLabels:        NewBarrierConfigItem(s.barrierLabels),
+		BarrierCleanupLease:  NewBarrierConfigItem(s.barrierCleanupLease),
+		BarrierLeaseDuration: NewBarrierConfigItem(s.barrierLeaseDuration),
+		BarrierRetryPeriod:   NewBarrierConfigItem(s.barrierRetryPeriod),
+		BarrierTimeout:       NewBarrierConfigItem(s.barrierTimeout),
+	}
+}
+
+func NewBarrierConfigBuilder() *BarrierConfigBuilder { return &BarrierConfigBuilder{} }
+func (s *BarrierConfig) Apply(opt ...BarrierConfigOption) {
+	for _, x := range opt {
+		x(s)
+	}
+}
+
+type BarrierConfigOption func(*BarrierConfig)
+
+func WithBarrierLabels(v labels.Set) BarrierConfigOption {
+	return func(c *BarrierConfig) {
+		c.BarrierLabels.Set(v)
+	}
+}
+func WithBarrierCleanupLease(v bool) BarrierConfigOption {
+	return func(c *BarrierConfig) {
+		c.BarrierCleanupLease.Set(v)
+	}
+}
+func WithBarrierLeaseDuration(v time.Duration) BarrierConfigOption {
+	return func(c *BarrierConfig) {
+		c.BarrierLeaseDuration.Set(v)
+	}
+}
+func WithBarrierRetryPeriod(v time.Duration) BarrierConfigOption {
+	return func(c *BarrierConfig) {
+		c.BarrierRetryPeriod.Set(v)
+	}
+}
+func WithBarrierTimeout(v time.Duration) BarrierConfigOption {
+	return func(c *BarrierConfig) {
+		c.BarrierTimeout.Set(v)
+	}
+}
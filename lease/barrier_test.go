@@ -0,0 +1,84 @@
+package lease_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Barrier", func() {
+	It("should release the participants once all have arrived", func() {
+		const (
+			name    = "barrier-release"
+			parties = 3
+		)
+		var (
+			wg    sync.WaitGroup
+			errs  = make([]error, parties)
+			times = make([]time.Time, parties)
+		)
+		for i := range parties {
+			barrier, err := lease.NewBarrier(namespace, name, name+"-"+string(rune('a'+i)), parties, clientIface,
+				lease.WithBarrierCleanupLease(true),
+				lease.WithBarrierRetryPeriod(100*time.Millisecond),
+			)
+			Expect(err).To(Succeed())
+			wg.Go(func() {
+				time.Sleep(time.Duration(i) * 300 * time.Millisecond)
+				errs[i] = barrier.Wait(ctx)
+				times[i] = time.Now()
+			})
+		}
+		wg.Wait()
+		for i := range parties {
+			Expect(errs[i]).To(Succeed())
+			// released after the last arrival
+			Expect(times[i].Sub(times[parties-1])).To(BeNumerically("~", 0, 300*time.Millisecond))
+		}
+		list, err := listLeases(ctx)
+		Expect(err).To(Succeed())
+		for _, x := range list.Items {
+			Expect(x.GetLabels()).NotTo(HaveKeyWithValue(lease.LabelBarrier, name))
+		}
+	})
+
+	It("should time out", func() {
+		const name = "barrier-timeout"
+		barrier, err := lease.NewBarrier(namespace, name, name+"-id", 2, clientIface,
+			lease.WithBarrierCleanupLease(true),
+			lease.WithBarrierRetryPeriod(100*time.Millisecond),
+			lease.WithBarrierTimeout(500*time.Millisecond),
+		)
+		Expect(err).To(Succeed())
+		Expect(barrier.Wait(ctx)).To(MatchError(lease.ErrBarrierTimedOut))
+	})
+
+	It("should not release the later participants by the remaining leases", func() {
+		const name = "barrier-generation"
+		newBarrier := func(id string, parties int) *lease.Barrier {
+			barrier, err := lease.NewBarrier(namespace, name, id, parties, clientIface,
+				lease.WithBarrierRetryPeriod(100*time.Millisecond),
+				lease.WithBarrierLeaseDuration(time.Second),
+				lease.WithBarrierTimeout(500*time.Millisecond),
+			)
+			Expect(err).To(Succeed())
+			return barrier
+		}
+		Expect(newBarrier(name+"-a", 1).Wait(ctx)).To(Succeed())
+		// the released lease of the earlier participant remains
+		Expect(newBarrier(name+"-b", 2).Wait(ctx)).To(MatchError(lease.ErrBarrierTimedOut))
+	})
+
+	It("should reject invalid name", func() {
+		_, err := lease.NewBarrier(namespace, "Barrier_Invalid", "id", 1, clientIface)
+		Expect(err).To(MatchError(lease.ErrInvalidBarrier))
+	})
+
+	It("should reject invalid parties", func() {
+		_, err := lease.NewBarrier(namespace, "barrier-invalid", "id", 0, clientIface)
+		Expect(err).To(MatchError(lease.ErrInvalidBarrier))
+	})
+})
@@ -0,0 +1,111 @@
+package lease
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// leasesGetter wraps the leases client used by the leader election
+// to observe the requests for the lease.
+type leasesGetter struct {
+	coordinationv1client.LeasesGetter
+	renew       *renewMonitor
+	annotations *annotator
+	guard       *nonceGuard
+}
+
+func newLeasesGetter(
+	client coordinationv1client.LeasesGetter,
+	renew *renewMonitor,
+	annotations *annotator,
+	guard *nonceGuard,
+) *leasesGetter {
+	return &leasesGetter{
+		LeasesGetter: client,
+		renew:        renew,
+		annotations:  annotations,
+		guard:        guard,
+	}
+}
+
+func (c *leasesGetter) Leases(namespace string) coordinationv1client.LeaseInterface {
+	return &leaseInterface{
+		LeaseInterface: c.LeasesGetter.Leases(namespace),
+		renew:          c.renew,
+		annotations:    c.annotations,
+		guard:          c.guard,
+	}
+}
+
+type leaseInterface struct {
+	coordinationv1client.LeaseInterface
+	renew       *renewMonitor
+	annotations *annotator
+	guard       *nonceGuard
+}
+
+// Get fails if the lease is held by another process with the same identity,
+// so that the leader election never takes it over.
+func (c *leaseInterface) Get(ctx context.Context, name string, opts metav1.GetOptions) (*coordinationv1.Lease, error) {
+	x, err := c.LeaseInterface.Get(ctx, name, opts)
+	if err == nil {
+		err = c.guard.check(x)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (c *leaseInterface) Create(ctx context.Context, lease *coordinationv1.Lease, opts metav1.CreateOptions) (*coordinationv1.Lease, error) {
+	x, err := c.LeaseInterface.Create(ctx, c.annotations.apply(lease), opts)
+	c.renew.observe(err)
+	return x, err
+}
+
+func (c *leaseInterface) Update(ctx context.Context, lease *coordinationv1.Lease, opts metav1.UpdateOptions) (*coordinationv1.Lease, error) {
+	x, err := c.LeaseInterface.Update(ctx, c.annotations.apply(lease), opts)
+	c.renew.observe(err)
+	return x, err
+}
+
+// annotator adds the annotations to the lease written by the leader election.
+type annotator struct {
+	mux         sync.Mutex
+	annotations map[string]string
+}
+
+func newAnnotator(annotations map[string]string) *annotator {
+	a := &annotator{}
+	a.set(annotations)
+	return a
+}
+
+func (a *annotator) set(annotations map[string]string) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.annotations == nil {
+		a.annotations = map[string]string{}
+	}
+	maps.Copy(a.annotations, annotations)
+}
+
+// apply returns the lease with the annotations.
+func (a *annotator) apply(lease *coordinationv1.Lease) *coordinationv1.Lease {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if len(a.annotations) == 0 {
+		return lease
+	}
+	x := lease.DeepCopy()
+	if x.Annotations == nil {
+		x.Annotations = map[string]string{}
+	}
+	maps.Copy(x.Annotations, a.annotations)
+	return x
+}
@@ -1,4 +1,4 @@
-// Code generated by "goconfig -field Labels labels.Set|CleanupLease bool|LeaderElectTimeout time.Duration|LeaseDuration time.Duration|RenewDeadline time.Duration|RetryPeriod time.Duration -option -output config_generated.go"; DO NOT EDIT.
+// Code generated by "goconfig -field Labels labels.Set|CleanupLease bool|LeaderElectTimeout time.Duration|LeaseDuration time.Duration|RenewDeadline time.Duration|RetryPeriod time.Duration|RenewWarningFraction float64|RecordLastRun bool|MinInterval time.Duration|ScheduledTime time.Time|Reentrant bool -option -output config_generated.go"; DO NOT EDIT.
 
 package lease
 
@@ -37,20 +37,30 @@ func NewConfigItem[T any](defaultValue T) *ConfigItem[T] {
 }
 
 type Config struct {
-	Labels             *ConfigItem[labels.Set]
-	CleanupLease       *ConfigItem[bool]
-	LeaderElectTimeout *ConfigItem[time.Duration]
-	LeaseDuration      *ConfigItem[time.Duration]
-	RenewDeadline      *ConfigItem[time.Duration]
-	RetryPeriod        *ConfigItem[time.Duration]
+	Labels               *ConfigItem[labels.Set]
+	CleanupLease         *ConfigItem[bool]
+	LeaderElectTimeout   *ConfigItem[time.Duration]
+	LeaseDuration        *ConfigItem[time.Duration]
+	RenewDeadline        *ConfigItem[time.Duration]
+	RetryPeriod          *ConfigItem[time.Duration]
+	RenewWarningFraction *ConfigItem[float64]
+	RecordLastRun        *ConfigItem[bool]
+	MinInterval          *ConfigItem[time.Duration]
+	ScheduledTime        *ConfigItem[time.Time]
+	Reentrant            *ConfigItem[bool]
 }
 type ConfigBuilder struct {
-	labels             labels.Set
-	cleanupLease       bool
-	leaderElectTimeout time.Duration
-	leaseDuration      time.Duration
-	renewDeadline      time.Duration
-	retryPeriod        time.Duration
+	labels               labels.Set
+	cleanupLease         bool
+	leaderElectTimeout   time.Duration
+	leaseDuration        time.Duration
+	renewDeadline        time.Duration
+	retryPeriod          time.Duration
+	renewWarningFraction float64
+	recordLastRun        bool
+	minInterval          time.Duration
+	scheduledTime        time.Time
+	reentrant            bool
 }
 
 func (s *ConfigBuilder) Labels(v labels.Set) *ConfigBuilder {
@@ -77,14 +87,39 @@ func (s *ConfigBuilder) RetryPeriod(v time.Duration) *ConfigBuilder {
 	s.retryPeriod = v
 	return s
 }
+func (s *ConfigBuilder) RenewWarningFraction(v float64) *ConfigBuilder {
+	s.renewWarningFraction = v
+	return s
+}
+func (s *ConfigBuilder) RecordLastRun(v bool) *ConfigBuilder {
+	s.recordLastRun = v
+	return s
+}
+func (s *ConfigBuilder) MinInterval(v time.Duration) *ConfigBuilder {
+	s.minInterval = v
+	return s
+}
+func (s *ConfigBuilder) ScheduledTime(v time.Time) *ConfigBuilder {
+	s.scheduledTime = v
+	return s
+}
+func (s *ConfigBuilder) Reentrant(v bool) *ConfigBuilder {
+	s.reentrant = v
+	return s
+}
 func (s *ConfigBuilder) Build() *Config {
 	return &Config{
-		Labels:             NewConfigItem(s.labels),
-		CleanupLease:       NewConfigItem(s.cleanupLease),
-		LeaderElectTimeout: NewConfigItem(s.leaderElectTimeout),
-		LeaseDuration:      NewConfigItem(s.leaseDuration),
-		RenewDeadline:      NewConfigItem(s.renewDeadline),
-		RetryPeriod:        NewConfigItem(s.retryPeriod),
+		Labels:               NewConfigItem(s.labels),
+		CleanupLease:         NewConfigItem(s.cleanupLease),
+		LeaderElectTimeout:   NewConfigItem(s.leaderElectTimeout),
+		LeaseDuration:        NewConfigItem(s.leaseDuration),
+		RenewDeadline:        NewConfigItem(s.renewDeadline),
+		RetryPeriod:          NewConfigItem(s.retryPeriod),
+		RenewWarningFraction: NewConfigItem(s.renewWarningFraction),
+		RecordLastRun:        NewConfigItem(s.recordLastRun),
+		MinInterval:          NewConfigItem(s.minInterval),
+		ScheduledTime:        NewConfigItem(s.scheduledTime),
+		Reentrant:            NewConfigItem(s.reentrant),
 	}
 }
 
@@ -127,3 +162,28 @@ func WithRetryPeriod(v time.Duration) ConfigOption {
 		c.RetryPeriod.Set(v)
 	}
 }
+func WithRenewWarningFraction(v float64) ConfigOption {
+	return func(c *Config) {
+		c.RenewWarningFraction.Set(v)
+	}
+}
+func WithRecordLastRun(v bool) ConfigOption {
+	return func(c *Config) {
+		c.RecordLastRun.Set(v)
+	}
+}
+func WithMinInterval(v time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.MinInterval.Set(v)
+	}
+}
+func WithScheduledTime(v time.Time) ConfigOption {
+	return func(c *Config) {
+		c.ScheduledTime.Set(v)
+	}
+}
+func WithReentrant(v bool) ConfigOption {
+	return func(c *Config) {
+		c.Reentrant.Set(v)
+	}
+}
@@ -0,0 +1,71 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFatal stops RunForever.
+var ErrFatal = errors.New("Fatal")
+
+// Fatal marks err as fatal so that RunForever returns it instead of campaigning again.
+func Fatal(err error) error {
+	return fmt.Errorf("%w: %w", ErrFatal, err)
+}
+
+// RunForever campaigns for the leadership and calls f while leader, repeatedly.
+//
+// A term ends when f returns or the leadership is lost; f is canceled in the latter case.
+// After each term, RunForever waits for backoff and campaigns again.
+// Returns only when ctx is canceled, f returns the error made by Fatal, the locker is invalid, or the identity collides.
+// Returns the cause of ctx if canceled, e.g. the error given by the caller ending the hold.
+func RunForever(ctx context.Context, locker *Locker, backoff time.Duration, f func(context.Context) error) error {
+	if locker == nil {
+		return fmt.Errorf("%w: locker is nil", ErrInvalidLocker)
+	}
+	if f == nil {
+		return fmt.Errorf("%w: f is nil", ErrInvalidLocker)
+	}
+	logger := locker.Logger(ctx)
+	for term := 1; ; term++ {
+		logger.V(0).Info("campaign", "term", term)
+		err := locker.LockAndRun(ctx, f)
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if errors.Is(err, ErrFatal) || errors.Is(err, ErrInvalidLocker) || errors.Is(err, ErrIdentityCollision) {
+			logger.Error(err, "term ended with fatal error", "term", term)
+			return err
+		}
+		logger.V(0).Info("term ended", "term", term, "leaderLost", errors.Is(err, ErrLeaderLost), "err", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// Forever is the Locker whose LockAndRun is RunForever.
+type Forever struct {
+	*Locker
+	backoff time.Duration
+}
+
+// NewForever creates the new Forever instance.
+//
+//   - locker: the lock
+//   - backoff: the delay between terms
+func NewForever(locker *Locker, backoff time.Duration) *Forever {
+	return &Forever{
+		Locker:  locker,
+		backoff: backoff,
+	}
+}
+
+// LockAndRun calls RunForever.
+func (s *Forever) LockAndRun(ctx context.Context, f func(context.Context) error) error {
+	return RunForever(ctx, s.Locker, s.backoff, f)
+}
@@ -0,0 +1,48 @@
+package lease_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RunForever", func() {
+	It("should campaign again until fatal error", func() {
+		const name = "run-forever-fatal"
+		locker, err := lease.NewLocker(namespace, name, name+"-id", clientIface)
+		Expect(err).To(Succeed())
+		var terms int
+		err = lease.RunForever(ctx, locker, 100*time.Millisecond, func(context.Context) error {
+			terms++
+			switch terms {
+			case 1:
+				return nil
+			case 2:
+				return errors.New("failure")
+			default:
+				return lease.Fatal(errors.New("fatal"))
+			}
+		})
+		Expect(err).To(MatchError(lease.ErrFatal))
+		Expect(terms).To(Equal(3))
+	})
+
+	It("should stop on cancel", func() {
+		const name = "run-forever-cancel"
+		locker, err := lease.NewLocker(namespace, name, name+"-id", clientIface)
+		Expect(err).To(Succeed())
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		var terms int
+		err = lease.RunForever(ctx, locker, 100*time.Millisecond, func(context.Context) error {
+			terms++
+			return nil
+		})
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(terms).To(BeNumerically(">", 1))
+	})
+})
@@ -0,0 +1,57 @@
+package lease
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+)
+
+// ErrIdentityCollision means another process holds the lease with the same identity.
+var ErrIdentityCollision = errors.New("IdentityCollision")
+
+// newNonce returns the random string distinguishing the processes with the same identity.
+func newNonce() string { return rand.Text() }
+
+// nonceGuard detects another process holding the lease with the same identity,
+// which the leader election regards as the same holder,
+// by the nonce annotated on the lease.
+type nonceGuard struct {
+	id, nonce string
+	once      sync.Once
+	collidedC chan struct{}
+}
+
+func newNonceGuard(id, nonce string) *nonceGuard {
+	return &nonceGuard{
+		id:        id,
+		nonce:     nonce,
+		collidedC: make(chan struct{}),
+	}
+}
+
+// check returns ErrIdentityCollision if the lease is held by the same identity with another nonce.
+func (g *nonceGuard) check(x *coordinationv1.Lease) error {
+	other, ok := x.GetAnnotations()[AnnotationHolderNonce]
+	if !ok || other == g.nonce || !heldBy(x, g.id, time.Now()) {
+		return nil
+	}
+	g.once.Do(func() { close(g.collidedC) })
+	return fmt.Errorf("%w: the lease is held by another process with the identity %s, nonce=%s",
+		ErrIdentityCollision, g.id, other)
+}
+
+// collided returns the channel closed when a collision is detected.
+func (g *nonceGuard) collided() <-chan struct{} { return g.collidedC }
+
+func (g *nonceGuard) hasCollided() bool {
+	select {
+	case <-g.collidedC:
+		return true
+	default:
+		return false
+	}
+}
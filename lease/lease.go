@@ -9,6 +9,7 @@ import (
 	"github.com/berquerant/k8s-lease/logging"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
@@ -19,6 +20,10 @@ import (
 var (
 	ErrInvalidLocker = errors.New("InvalidLocker")
 	ErrElectTimedOut = errors.New("ElectTimedOut")
+	// ErrLeaderLost is returned by LockAndRun when the leadership is lost while the function is running.
+	ErrLeaderLost = errors.New("LeaderLost")
+	// ErrSkipped is returned by LockAndRun when the function is not invoked because it has already run.
+	ErrSkipped = errors.New("Skipped")
 )
 
 const (
@@ -33,7 +38,7 @@ const (
 	cleanupTimeout = 5 * time.Second
 )
 
-//go:generate go tool goconfig -field "Labels labels.Set|CleanupLease bool|LeaderElectTimeout time.Duration|LeaseDuration time.Duration|RenewDeadline time.Duration|RetryPeriod time.Duration" -option -output config_generated.go
+//go:generate go tool goconfig -field "Labels labels.Set|CleanupLease bool|LeaderElectTimeout time.Duration|LeaseDuration time.Duration|RenewDeadline time.Duration|RetryPeriod time.Duration|RenewWarningFraction float64|RecordLastRun bool|MinInterval time.Duration|ScheduledTime time.Time|Reentrant bool" -option -output config_generated.go
 
 // NewLocker creates the new Locker instance.
 //
@@ -50,6 +55,11 @@ const (
 //   - WithRenewDuration: the time limit for the leader to successfully renew its lock before stepping down (default: 10 seconds)
 //   - WithRetryPeriod: the time interval between each attempt to acquire or renew the lock (default: 2 seconds)
 //   - WithLeaderElectTimeout: the timeout of the leader election (default: unlimited(0))
+//   - WithRenewWarningFraction: the fraction of RenewDeadline for which the lease can go unrenewed, failing or hanging, before RenewWarning is notified (default: disabled(0))
+//   - WithRecordLastRun: if true, record the result of the run on the lease annotations on release; conflicts with WithCleanupLease (default: false)
+//   - WithScheduledTime: skip the run if the scheduled time recorded on the lease is not before it, otherwise record it (default: disabled(zero))
+//   - WithMinInterval: skip the run if the last success recorded on the lease is within the interval; implies WithRecordLastRun (default: disabled(0))
+//   - WithReentrant: if true, call f immediately if the lease is already held by the same id, without releasing it (default: false)
 func NewLocker(
 	namespace, name, id string,
 	client coordinationv1client.LeasesGetter,
@@ -58,8 +68,8 @@ func NewLocker(
 	if namespace == "" {
 		return nil, fmt.Errorf("%w: namespace is empty", ErrInvalidLocker)
 	}
-	if name == "" {
-		return nil, fmt.Errorf("%w: name is empty", ErrInvalidLocker)
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: invalid name %q: %v", ErrInvalidLocker, name, errs)
 	}
 	if id == "" {
 		return nil, fmt.Errorf("%w: id is empty", ErrInvalidLocker)
@@ -74,10 +84,27 @@ func NewLocker(
 		RenewDeadline(DefaultRenewDeadline).
 		RetryPeriod(DefaultRetryPeriod).
 		LeaderElectTimeout(0).
+		RenewWarningFraction(0).
+		RecordLastRun(false).
+		MinInterval(0).
+		ScheduledTime(time.Time{}).
+		Reentrant(false).
 		Build()
 	for _, f := range opt {
 		f(config)
 	}
+	if x := config.RenewWarningFraction.Get(); x < 0 || x >= 1 {
+		return nil, fmt.Errorf("%w: renew warning fraction should be in [0, 1): %f", ErrInvalidLocker, x)
+	}
+	if x := config.MinInterval.Get(); x < 0 {
+		return nil, fmt.Errorf("%w: min interval should not be negative: %s", ErrInvalidLocker, x)
+	}
+	if config.MinInterval.Get() > 0 && config.CleanupLease.Get() {
+		return nil, fmt.Errorf("%w: min interval requires the lease to be kept", ErrInvalidLocker)
+	}
+	if config.RecordLastRun.Get() && config.CleanupLease.Get() {
+		return nil, fmt.Errorf("%w: record last run requires the lease to be kept", ErrInvalidLocker)
+	}
 	return &Locker{
 		namespace:          namespace,
 		name:               name,
@@ -89,6 +116,12 @@ func NewLocker(
 		renewDeadline:      config.RenewDeadline.Get(),
 		retryPeriod:        config.RetryPeriod.Get(),
 		leaderElectTimeout: config.LeaderElectTimeout.Get(),
+		renewWarning:       config.RenewWarningFraction.Get(),
+		recordLastRun:      config.RecordLastRun.Get() || config.MinInterval.Get() > 0,
+		minInterval:        config.MinInterval.Get(),
+		scheduledTime:      config.ScheduledTime.Get(),
+		reentrant:          config.Reentrant.Get(),
+		nonce:              newNonce(),
 	}, nil
 }
 
@@ -101,6 +134,13 @@ type Locker struct {
 	labels                                                        labels.Set
 	needCleanup                                                   bool
 	leaderElectTimeout, leaseDuration, renewDeadline, retryPeriod time.Duration
+	renewWarning                                                  float64
+	recordLastRun                                                 bool
+	minInterval                                                   time.Duration
+	scheduledTime                                                 time.Time
+	shardKey                                                      string
+	reentrant                                                     bool
+	nonce                                                         string
 }
 
 func (s *Locker) Namespace() string { return s.namespace }
@@ -130,14 +170,24 @@ func (s *Locker) Labels() labels.Set {
 //
 // Do the following:
 //
+//   - call `f` within the current hold if reentrant and the lease is held by the same id
 //   - try to acquire leadership
+//   - abort with ErrIdentityCollision if another process holds the lease with the same id
 //   - abort if the leader election timed out
+//   - skip `f` if the last success is within the min interval, or the scheduled time has been run
 //   - invoke `f` when leadership is acquired
+//   - cancel `f` and return ErrLeaderLost if leadership is lost
+//   - record the result of `f` on the lease annotations when releasing it, if needed
 //   - delete the lease if needed
 func (s *Locker) LockAndRun(ctx context.Context, f func(context.Context) error) error {
 	if f == nil {
 		return fmt.Errorf("%w: f is nil", ErrInvalidLocker)
 	}
+	if s.reentrant {
+		if ok, err := s.reenter(ctx, f); ok {
+			return err
+		}
+	}
 
 	parentCtx := ctx // keep a reference before WithCancel for use in cleanup
 	ctx, cancel := context.WithCancel(ctx)
@@ -182,12 +232,15 @@ func (s *Locker) LockAndRun(ctx context.Context, f func(context.Context) error)
 	}()
 
 	var (
-		leaseLock = &resourcelock.LeaseLock{
+		renew       = &renewMonitor{}
+		guard       = newNonceGuard(s.id, s.nonce)
+		annotations = newAnnotator(s.holderAnnotations())
+		leaseLock   = &resourcelock.LeaseLock{
 			LeaseMeta: metav1.ObjectMeta{
 				Namespace: s.namespace,
 				Name:      s.name,
 			},
-			Client: s.client,
+			Client: newLeasesGetter(s.client, renew, annotations, guard),
 			LockConfig: resourcelock.ResourceLockConfig{
 				Identity: s.id,
 			},
@@ -199,7 +252,33 @@ func (s *Locker) LockAndRun(ctx context.Context, f func(context.Context) error)
 			OnStartedLeading: func(ctx context.Context) {
 				close(startedC) // notify started leading
 				logger.V(1).Info("become leader")
+				renew.reset()
+				if s.renewWarning > 0 {
+					warner := newRenewWarner()
+					// the renewal is attempted every RetryPeriod and lost after RenewDeadline
+					threshold := s.retryPeriod + time.Duration(float64(s.renewDeadline)*s.renewWarning)
+					go renew.warn(ctx, logger, threshold, s.retryPeriod/2, warner)
+					ctx = withRenewWarning(ctx, warner)
+				}
+				if err := s.checkBeforeRun(ctx, annotations); err != nil {
+					cancel()
+					onStartedLeadingDoneC <- err
+					return
+				}
+				startTime := time.Now()
 				err := f(ctx)
+				if ctx.Err() != nil && parentCtx.Err() == nil && !guard.hasCollided() {
+					// canceled by the leader election, not by the caller
+					err = errors.Join(ErrLeaderLost, err)
+				}
+				if s.recordLastRun && !errors.Is(err, ErrSkipped) {
+					// written by the release of the lease
+					annotations.set(s.lastRun(startTime, time.Now(), err).intoAnnotations())
+				}
+				if s.reentrant {
+					// the nested holders end with the outermost one
+					annotations.set(map[string]string{AnnotationReentrantDepth: "0"})
+				}
 				cancel()
 				onStartedLeadingDoneC <- err
 			},
@@ -212,6 +291,9 @@ func (s *Locker) LockAndRun(ctx context.Context, f func(context.Context) error)
 					return
 				}
 				logger.V(1).Info("leader elected", "id", identity)
+				if s.shardKey != "" {
+					s.logShardContention(ctx, logger, identity)
+				}
 			},
 		}
 		electionConfig = leaderelection.LeaderElectionConfig{
@@ -224,19 +306,33 @@ func (s *Locker) LockAndRun(ctx context.Context, f func(context.Context) error)
 		}
 	)
 
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-guard.collided():
+			logger.Error(ErrIdentityCollision, "another process holds the lease with the same identity; use a distinct identity")
+			cancel()
+		}
+	}()
+
 	leaderelection.RunOrDie(ctx, electionConfig)
 	var errs []error
+	if guard.hasCollided() {
+		errs = append(errs, ErrIdentityCollision)
+	}
 	switch <-electResultC {
 	case electTimedOut:
 		errs = append(errs, ErrElectTimedOut)
 	case electCanceled:
-		errs = append(errs, ctx.Err())
+		if !guard.hasCollided() {
+			errs = append(errs, ctx.Err())
+		}
 	case electSucceeded:
 		errs = append(errs, <-onStartedLeadingDoneC)
 	}
 	cancel()
 
-	if s.needCleanup {
+	if s.needCleanup && !guard.hasCollided() {
 		logger.V(1).Info("cleanup lease")
 		if err := s.cleanup(parentCtx); err != nil {
 			errs = append(errs, fmt.Errorf("%w: failed to cleanup lease: %s", err, s))
@@ -245,6 +341,80 @@ func (s *Locker) LockAndRun(ctx context.Context, f func(context.Context) error)
 	return errors.Join(errs...)
 }
 
+// holderAnnotations returns the annotations written while holding the lease.
+func (s *Locker) holderAnnotations() map[string]string {
+	a := map[string]string{
+		AnnotationHolderNonce: s.nonce,
+	}
+	if s.shardKey != "" {
+		a[AnnotationShardKey] = s.shardKey
+	}
+	return a
+}
+
+func (s *Locker) lastRun(startTime, endTime time.Time, err error) *LastRun {
+	r := &LastRun{
+		StartTime: startTime,
+		EndTime:   endTime,
+		ExitCode:  ExitCode(err),
+		Holder:    s.id,
+	}
+	if r.ExitCode == 0 {
+		r.SuccessTime = endTime
+	}
+	return r
+}
+
+// checkBeforeRun returns ErrSkipped if the run should be skipped.
+func (s *Locker) checkBeforeRun(ctx context.Context, annotations *annotator) error {
+	if s.minInterval == 0 && s.scheduledTime.IsZero() {
+		return nil
+	}
+	x, err := s.client.Leases(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("%w: failed to get the lease", err)
+	}
+	if err := s.checkMinInterval(ctx, x.GetAnnotations()); err != nil {
+		return err
+	}
+	return s.checkScheduledTime(ctx, x.GetAnnotations(), annotations)
+}
+
+// checkScheduledTime returns ErrSkipped if the scheduled time is not after the recorded one,
+// otherwise records the scheduled time.
+func (s *Locker) checkScheduledTime(ctx context.Context, current map[string]string, annotations *annotator) error {
+	if s.scheduledTime.IsZero() {
+		return nil
+	}
+	if v, ok := current[AnnotationScheduledTime]; ok {
+		if last, err := time.Parse(time.RFC3339, v); err == nil && !last.Before(s.scheduledTime) {
+			s.Logger(ctx).V(0).Info("skip the run", "scheduledTime", s.scheduledTime, "lastScheduledTime", last)
+			return fmt.Errorf("%w: scheduled time %s has been run", ErrSkipped, s.scheduledTime.Format(time.RFC3339))
+		}
+	}
+	// written by the renewal or the release of the lease
+	annotations.set(map[string]string{
+		AnnotationScheduledTime: s.scheduledTime.Format(time.RFC3339),
+	})
+	return nil
+}
+
+// checkMinInterval returns ErrSkipped if the last success is within the min interval.
+func (s *Locker) checkMinInterval(ctx context.Context, current map[string]string) error {
+	if s.minInterval == 0 {
+		return nil
+	}
+	r := lastRunFromAnnotations(current)
+	if r == nil || r.SuccessTime.IsZero() {
+		return nil
+	}
+	if elapsed := time.Since(r.SuccessTime); elapsed < s.minInterval {
+		s.Logger(ctx).V(0).Info("skip the run", "lastSuccess", r.SuccessTime, "minInterval", s.minInterval)
+		return fmt.Errorf("%w: last success at %s is within %s", ErrSkipped, r.SuccessTime.Format(time.RFC3339), s.minInterval)
+	}
+	return nil
+}
+
 // cleanup deletes the created lease.
 // parentCtx is the context passed to LockAndRun before internal cancellation;
 // it remains valid for external signals (e.g. SIGTERM) during cleanup.
@@ -4,14 +4,19 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/berquerant/k8s-lease/lease"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8slabels "k8s.io/apimachinery/pkg/labels"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 )
 
 type sleeper struct {
@@ -37,6 +42,37 @@ func (s *sleeper) sleep(ctx context.Context) error {
 	return s.err
 }
 
+// failingLeasesGetter fails updates of leases while failing is true,
+// or blocks them until ctx is done while hanging is true.
+type failingLeasesGetter struct {
+	coordinationv1client.LeasesGetter
+	failing atomic.Bool
+	hanging atomic.Bool
+}
+
+func (c *failingLeasesGetter) Leases(namespace string) coordinationv1client.LeaseInterface {
+	return &failingLeaseInterface{
+		LeaseInterface: c.LeasesGetter.Leases(namespace),
+		getter:         c,
+	}
+}
+
+type failingLeaseInterface struct {
+	coordinationv1client.LeaseInterface
+	getter *failingLeasesGetter
+}
+
+func (c *failingLeaseInterface) Update(ctx context.Context, lease *coordinationv1.Lease, opts metav1.UpdateOptions) (*coordinationv1.Lease, error) {
+	if c.getter.failing.Load() {
+		return nil, errors.New("failing")
+	}
+	if c.getter.hanging.Load() {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return c.LeaseInterface.Update(ctx, lease, opts)
+}
+
 func newSleeper(name string, duration time.Duration) *sleeper {
 	return &sleeper{
 		name:     name,
@@ -64,6 +100,313 @@ var _ = Describe("Locker", func() {
 		})
 	})
 
+	Context("RenewWarning", func() {
+		It("should warn before the leadership is lost", func() {
+			const name = "renew-warning"
+			client := &failingLeasesGetter{LeasesGetter: clientIface}
+			locker, err := lease.NewLocker(namespace, name, name+"-id", client,
+				lease.WithLeaseDuration(3*time.Second),
+				lease.WithRenewDeadline(2*time.Second),
+				lease.WithRetryPeriod(200*time.Millisecond),
+				lease.WithRenewWarningFraction(0.3),
+			)
+			Expect(err).To(Succeed())
+			var warned, canceled bool
+			Expect(locker.LockAndRun(ctx, func(ctx context.Context) error {
+				warnC := lease.RenewWarning(ctx)
+				Expect(warnC).NotTo(BeNil())
+				client.failing.Store(true)
+				select {
+				case <-warnC:
+					warned = true
+				case <-ctx.Done():
+					return nil
+				}
+				<-ctx.Done()
+				canceled = true
+				return nil
+			})).To(Succeed())
+			Expect(warned).To(BeTrue())
+			Expect(canceled).To(BeTrue())
+		})
+
+		It("should warn while the renewal hangs", func() {
+			const name = "renew-warning-hanging"
+			client := &failingLeasesGetter{LeasesGetter: clientIface}
+			locker, err := lease.NewLocker(namespace, name, name+"-id", client,
+				lease.WithLeaseDuration(3*time.Second),
+				lease.WithRenewDeadline(2*time.Second),
+				lease.WithRetryPeriod(200*time.Millisecond),
+				lease.WithRenewWarningFraction(0.3),
+			)
+			Expect(err).To(Succeed())
+			var warned bool
+			Expect(locker.LockAndRun(ctx, func(ctx context.Context) error {
+				client.hanging.Store(true)
+				select {
+				case <-lease.RenewWarning(ctx):
+					warned = true
+				case <-ctx.Done():
+				}
+				<-ctx.Done()
+				return nil
+			})).To(MatchError(lease.ErrLeaderLost))
+			Expect(warned).To(BeTrue())
+		})
+
+		It("should not be available without the fraction", func() {
+			const name = "renew-warning-disabled"
+			locker, err := lease.NewLocker(namespace, name, name+"-id", clientIface)
+			Expect(err).To(Succeed())
+			Expect(locker.LockAndRun(ctx, func(ctx context.Context) error {
+				Expect(lease.RenewWarning(ctx)).To(BeNil())
+				return nil
+			})).To(Succeed())
+		})
+	})
+
+	Context("LeaderLost", func() {
+		It("should return ErrLeaderLost", func() {
+			const name = "leader-lost"
+			client := &failingLeasesGetter{LeasesGetter: clientIface}
+			locker, err := lease.NewLocker(namespace, name, name+"-id", client,
+				lease.WithLeaseDuration(3*time.Second),
+				lease.WithRenewDeadline(2*time.Second),
+				lease.WithRetryPeriod(200*time.Millisecond),
+			)
+			Expect(err).To(Succeed())
+			Expect(locker.LockAndRun(ctx, func(ctx context.Context) error {
+				client.failing.Store(true)
+				<-ctx.Done()
+				return nil
+			})).To(MatchError(lease.ErrLeaderLost))
+		})
+	})
+
+	Context("RecordLastRun", func() {
+		It("should record the last run", func() {
+			const name = "record-last-run"
+			locker, err := lease.NewLocker(namespace, name, name+"-id", clientIface, lease.WithRecordLastRun(true))
+			Expect(err).To(Succeed())
+			Expect(locker.LockAndRun(ctx, newSleeper(name, time.Millisecond*100).sleep)).To(Succeed())
+			status, err := lease.GetStatus(ctx, clientIface, namespace, name)
+			Expect(err).To(Succeed())
+			Expect(status.LastRun).NotTo(BeNil())
+			Expect(status.LastRun.ExitCode).To(Equal(0))
+			Expect(status.LastRun.Holder).To(Equal(name + "-id"))
+			Expect(status.LastRun.SuccessTime.IsZero()).To(BeFalse())
+			successTime := status.LastRun.SuccessTime
+
+			time.Sleep(time.Second) // the annotations are in seconds
+			s := newSleeper(name, time.Millisecond*100)
+			s.err = errors.New("failure")
+			Expect(locker.LockAndRun(ctx, s.sleep)).To(MatchError(s.err))
+			status, err = lease.GetStatus(ctx, clientIface, namespace, name)
+			Expect(err).To(Succeed())
+			Expect(status.LastRun.ExitCode).To(Equal(1))
+			Expect(status.LastRun.SuccessTime).To(Equal(successTime))
+			Expect(status.LastRun.EndTime.After(successTime)).To(BeTrue())
+		})
+
+		It("should not record without the option", func() {
+			const name = "record-last-run-disabled"
+			locker, err := lease.NewLocker(namespace, name, name+"-id", clientIface)
+			Expect(err).To(Succeed())
+			Expect(locker.LockAndRun(ctx, newSleeper(name, time.Millisecond*100).sleep)).To(Succeed())
+			status, err := lease.GetStatus(ctx, clientIface, namespace, name)
+			Expect(err).To(Succeed())
+			Expect(status.LastRun).To(BeNil())
+		})
+
+		It("should reject cleanup", func() {
+			_, err := lease.NewLocker(namespace, "record-last-run-cleanup", "id", clientIface,
+				lease.WithRecordLastRun(true),
+				lease.WithCleanupLease(true),
+			)
+			Expect(err).To(MatchError(lease.ErrInvalidLocker))
+		})
+	})
+
+	Context("MinInterval", func() {
+		It("should skip the run within the interval", func() {
+			const name = "min-interval"
+			locker, err := lease.NewLocker(namespace, name, name+"-id", clientIface, lease.WithMinInterval(time.Hour))
+			Expect(err).To(Succeed())
+			s := newSleeper(name, time.Millisecond*100)
+			s.err = errors.New("failure")
+			Expect(locker.LockAndRun(ctx, s.sleep)).To(MatchError(s.err))
+			Expect(s.called).To(BeTrue())
+
+			// failures do not count
+			s = newSleeper(name, time.Millisecond*100)
+			Expect(locker.LockAndRun(ctx, s.sleep)).To(Succeed())
+			Expect(s.called).To(BeTrue())
+
+			s = newSleeper(name, time.Millisecond*100)
+			Expect(locker.LockAndRun(ctx, s.sleep)).To(MatchError(lease.ErrSkipped))
+			Expect(s.called).To(BeFalse())
+		})
+
+		It("should reject cleanup", func() {
+			_, err := lease.NewLocker(namespace, "min-interval-cleanup", "id", clientIface,
+				lease.WithMinInterval(time.Hour),
+				lease.WithCleanupLease(true),
+			)
+			Expect(err).To(MatchError(lease.ErrInvalidLocker))
+		})
+	})
+
+	Context("ScheduledTime", func() {
+		It("should run each scheduled time once", func() {
+			const name = "scheduled-time"
+			var (
+				tick = time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)
+				run  = func(t time.Time) (bool, error) {
+					locker, err := lease.NewLocker(namespace, name, name+"-id", clientIface, lease.WithScheduledTime(t))
+					Expect(err).To(Succeed())
+					s := newSleeper(name, 0)
+					err = locker.LockAndRun(ctx, s.sleep)
+					return s.called, err
+				}
+			)
+			called, err := run(tick)
+			Expect(err).To(Succeed())
+			Expect(called).To(BeTrue())
+
+			called, err = run(tick)
+			Expect(err).To(MatchError(lease.ErrSkipped))
+			Expect(called).To(BeFalse())
+
+			called, err = run(tick.Add(-time.Minute))
+			Expect(err).To(MatchError(lease.ErrSkipped))
+			Expect(called).To(BeFalse())
+
+			called, err = run(tick.Add(time.Minute))
+			Expect(err).To(Succeed())
+			Expect(called).To(BeTrue())
+
+			status, err := lease.GetStatus(ctx, clientIface, namespace, name)
+			Expect(err).To(Succeed())
+			Expect(status.ScheduledTime).To(BeTemporally("==", tick.Add(time.Minute)))
+		})
+	})
+
+	Context("Once", func() {
+		It("should run once per key", func() {
+			const name = "once"
+			locker, err := lease.NewLocker(namespace, name, name+"-id", clientIface, lease.WithCleanupLease(true))
+			Expect(err).To(Succeed())
+			once, err := lease.NewOnce(locker, "v1", false)
+			Expect(err).To(Succeed())
+
+			s := newSleeper(name, time.Millisecond*100)
+			s.err = errors.New("failure")
+			Expect(once.LockAndRun(ctx, s.sleep)).To(MatchError(s.err))
+			_, ok, err := once.Completed(ctx)
+			Expect(err).To(Succeed())
+			Expect(ok).To(BeFalse())
+
+			s = newSleeper(name, time.Millisecond*100)
+			Expect(once.LockAndRun(ctx, s.sleep)).To(Succeed())
+			Expect(s.called).To(BeTrue())
+			_, ok, err = once.Completed(ctx)
+			Expect(err).To(Succeed())
+			Expect(ok).To(BeTrue())
+
+			s = newSleeper(name, time.Millisecond*100)
+			Expect(once.LockAndRun(ctx, s.sleep)).To(MatchError(lease.ErrSkipped))
+			Expect(s.called).To(BeFalse())
+
+			By("another key")
+			other, err := lease.NewOnce(locker, "v2", false)
+			Expect(err).To(Succeed())
+			s = newSleeper(name, time.Millisecond*100)
+			Expect(other.LockAndRun(ctx, s.sleep)).To(Succeed())
+			Expect(s.called).To(BeTrue())
+
+			By("force")
+			forced, err := lease.NewOnce(locker, "v1", true)
+			Expect(err).To(Succeed())
+			s = newSleeper(name, time.Millisecond*100)
+			Expect(forced.LockAndRun(ctx, s.sleep)).To(Succeed())
+			Expect(s.called).To(BeTrue())
+		})
+
+		It("should reject invalid keys", func() {
+			locker, err := lease.NewLocker(namespace, "once-invalid", "id", clientIface)
+			Expect(err).To(Succeed())
+			_, err = lease.NewOnce(locker, "in valid", false)
+			Expect(err).To(MatchError(lease.ErrInvalidLocker))
+		})
+	})
+
+	Context("Reentrant", func() {
+		It("should run the nested holder with the same id immediately", func() {
+			const name = "reentrant"
+			newReentrant := func(id string) *lease.Locker {
+				locker, err := lease.NewLocker(namespace, name, id, clientIface,
+					lease.WithReentrant(true),
+					lease.WithRetryPeriod(200*time.Millisecond),
+					lease.WithLeaderElectTimeout(time.Second),
+				)
+				Expect(err).To(Succeed())
+				return locker
+			}
+			var (
+				depth    string
+				innerErr error
+				otherErr error
+			)
+			Expect(newReentrant(name+"-id").LockAndRun(ctx, func(ctx context.Context) error {
+				innerErr = newReentrant(name+"-id").LockAndRun(ctx, func(ctx context.Context) error {
+					x, err := clientIface.Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+					Expect(err).To(Succeed())
+					depth = x.GetAnnotations()[lease.AnnotationReentrantDepth]
+					return nil
+				})
+				otherErr = newReentrant(name+"-other").LockAndRun(ctx, newSleeper(name, 0).sleep)
+				// renew the lease updated by the nested holder
+				time.Sleep(time.Second)
+				return nil
+			})).To(Succeed())
+			Expect(innerErr).To(Succeed())
+			Expect(depth).To(Equal("1"))
+			Expect(otherErr).To(MatchError(lease.ErrElectTimedOut))
+
+			By("released by the outermost holder")
+			x, err := clientIface.Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+			Expect(err).To(Succeed())
+			Expect(ptr.Deref(x.Spec.HolderIdentity, "")).To(BeEmpty())
+			Expect(x.GetAnnotations()).To(HaveKeyWithValue(lease.AnnotationReentrantDepth, "0"))
+		})
+	})
+
+	Context("IdentityCollision", func() {
+		It("should fail if another locker holds the lease with the same id", func() {
+			const name = "identity-collision"
+			first, err := lease.NewLocker(namespace, name, name+"-id", clientIface)
+			Expect(err).To(Succeed())
+			second, err := lease.NewLocker(namespace, name, name+"-id", clientIface,
+				lease.WithLeaderElectTimeout(5*time.Second),
+			)
+			Expect(err).To(Succeed())
+			var (
+				s         = newSleeper(name, 0)
+				secondErr error
+			)
+			Expect(first.LockAndRun(ctx, func(ctx context.Context) error {
+				secondErr = second.LockAndRun(ctx, s.sleep)
+				return nil
+			})).To(Succeed())
+			Expect(secondErr).To(MatchError(lease.ErrIdentityCollision))
+			Expect(s.called).To(BeFalse())
+
+			By("the next locker with the same id after the release")
+			Expect(second.LockAndRun(ctx, s.sleep)).To(Succeed())
+			Expect(s.called).To(BeTrue())
+		})
+	})
+
 	Context("OneTime", func() {
 		It("should return internal error", func() {
 			const name = "onetime-internal-error"
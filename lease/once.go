@@ -0,0 +1,144 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// onceSuffix is the suffix of the name of the companion lease that records the completed keys.
+	onceSuffix = "-once"
+	// annotationOncePrefix is the prefix of the annotations of the completed keys, the values are the completion times.
+	annotationOncePrefix = annotationPrefix + "once-"
+)
+
+// Once runs the function under the lock at most once per key.
+//
+// The completion of the key is recorded on the companion lease named `<name>-once`,
+// so it survives the deletion of the lease by WithCleanupLease.
+type Once struct {
+	*Locker
+	key   string
+	force bool
+}
+
+// NewOnce creates the new Once instance.
+//
+//   - locker: the lock
+//   - key: the key of the work, up to 58 characters of alphanumerics, '-', '_' or '.'
+//   - force: if true, run the function even if the key has been completed
+func NewOnce(locker *Locker, key string, force bool) (*Once, error) {
+	if locker == nil {
+		return nil, fmt.Errorf("%w: locker is nil", ErrInvalidLocker)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("%w: once key is empty", ErrInvalidLocker)
+	}
+	if errs := validation.IsQualifiedName(annotationOncePrefix + key); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: invalid once key %q: %v", ErrInvalidLocker, key, errs)
+	}
+	return &Once{
+		Locker: locker,
+		key:    key,
+		force:  force,
+	}, nil
+}
+
+func (s *Once) Key() string { return s.key }
+
+func (s *Once) String() string {
+	return fmt.Sprintf("%s key=%s", s.Locker, s.key)
+}
+
+// LockAndRun tries to call f with the lease unless the key has been completed.
+//
+// Returns ErrSkipped without invoking f if the key has been completed and not forced.
+// Records the completion of the key if f succeeds.
+func (s *Once) LockAndRun(ctx context.Context, f func(context.Context) error) error {
+	if f == nil {
+		return fmt.Errorf("%w: f is nil", ErrInvalidLocker)
+	}
+	return s.Locker.LockAndRun(ctx, func(ctx context.Context) error {
+		logger := s.Logger(ctx).WithValues("key", s.key)
+		completedAt, ok, err := s.Completed(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: failed to get the completion", err)
+		}
+		if ok {
+			if !s.force {
+				logger.V(0).Info("skip the run", "completed", completedAt)
+				return fmt.Errorf("%w: key %s completed at %s", ErrSkipped, s.key, completedAt.Format(time.RFC3339))
+			}
+			logger.V(0).Info("force the run", "completed", completedAt)
+		}
+		if err := f(ctx); err != nil {
+			return err
+		}
+		if err := s.complete(ctx); err != nil {
+			return fmt.Errorf("%w: failed to record the completion", err)
+		}
+		logger.V(1).Info("completed")
+		return nil
+	})
+}
+
+func (s *Once) onceName() string { return s.name + onceSuffix }
+
+// Completed returns the completion time of the key and true if the key has been completed.
+func (s *Once) Completed(ctx context.Context) (time.Time, bool, error) {
+	x, err := s.client.Leases(s.namespace).Get(ctx, s.onceName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	v, ok := x.GetAnnotations()[annotationOncePrefix+s.key]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	t, _ := time.Parse(time.RFC3339, v)
+	return t, true, nil
+}
+
+// complete records the completion of the key on the companion lease.
+func (s *Once) complete(ctx context.Context) error {
+	var (
+		c           = s.client.Leases(s.namespace)
+		annotations = map[string]string{
+			annotationOncePrefix + s.key: time.Now().Format(time.RFC3339),
+		}
+	)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		x, err := c.Get(ctx, s.onceName(), metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			_, err := c.Create(ctx, &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   s.namespace,
+					Name:        s.onceName(),
+					Labels:      s.Labels(),
+					Annotations: annotations,
+				},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		x = x.DeepCopy()
+		if x.Annotations == nil {
+			x.Annotations = map[string]string{}
+		}
+		maps.Copy(x.Annotations, annotations)
+		_, err = c.Update(ctx, x, metav1.UpdateOptions{})
+		return err
+	})
+}
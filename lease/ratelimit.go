@@ -0,0 +1,308 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/berquerant/k8s-lease/logging"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+var (
+	ErrInvalidRateLimiter = errors.New("InvalidRateLimiter")
+	ErrInvalidRate        = errors.New("InvalidRate")
+	ErrRateLimited        = errors.New("RateLimited")
+)
+
+// Annotations of the token bucket stored on the lease.
+const (
+	AnnotationRateLimitTokens = annotationPrefix + "ratelimit-tokens"
+	AnnotationRateLimitTime   = annotationPrefix + "ratelimit-time"
+)
+
+// Rate is the number of the tokens added to the bucket per the duration.
+type Rate struct {
+	Count int
+	Per   time.Duration
+}
+
+// ParseRate parses the rate like "10/m".
+//
+// The unit is s, m, h or a duration like 30s.
+func ParseRate(s string) (Rate, error) {
+	count, unit, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("%w: %s", ErrInvalidRate, s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return Rate{}, fmt.Errorf("%w: count should be a positive integer: %s", ErrInvalidRate, s)
+	}
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		per, err = time.ParseDuration(unit)
+		if err != nil || per <= 0 {
+			return Rate{}, fmt.Errorf("%w: unit should be s, m, h or a positive duration: %s", ErrInvalidRate, s)
+		}
+	}
+	return Rate{
+		Count: n,
+		Per:   per,
+	}, nil
+}
+
+func (r Rate) String() string { return fmt.Sprintf("%d/%s", r.Count, r.Per) }
+
+// perSecond returns the number of the tokens added per second.
+func (r Rate) perSecond() float64 { return float64(r.Count) / r.Per.Seconds() }
+
+// rateLimitBackoff is the backoff of the retries on conflicts.
+// More steps than retry.DefaultRetry because many clients may take tokens at the same time.
+var rateLimitBackoff = wait.Backoff{
+	Steps:    10,
+	Duration: 10 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.5,
+}
+
+//go:generate go tool goconfig -field "RateLimitLabels labels.Set|RateLimitTimeout time.Duration|RateLimitNoWait bool" -option -prefix RateLimit -output ratelimit_config_generated.go
+
+// NewRateLimiter creates the new RateLimiter instance.
+//
+//   - namespace: the namespace of a lease
+//   - name: the name of a lease
+//   - id: the id of the client
+//   - rate: the rate of the tokens added to the bucket
+//   - burst: the capacity of the bucket; 0 means rate.Count
+//   - client: the leases client
+//
+// Available options:
+//
+//   - WithRateLimitLabels: the additional labels of a lease
+//   - WithRateLimitTimeout: the time limit of waiting for a token (default: unlimited(0))
+//   - WithRateLimitNoWait: if true, fail immediately if no token is available (default: false)
+func NewRateLimiter(
+	namespace, name, id string,
+	rate Rate,
+	burst int,
+	client coordinationv1client.LeasesGetter,
+	opt ...RateLimitConfigOption,
+) (*RateLimiter, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("%w: namespace is empty", ErrInvalidRateLimiter)
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: invalid name %q: %v", ErrInvalidRateLimiter, name, errs)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is empty", ErrInvalidRateLimiter)
+	}
+	if rate.Count < 1 || rate.Per <= 0 {
+		return nil, fmt.Errorf("%w: invalid rate: %s", ErrInvalidRateLimiter, rate)
+	}
+	if burst < 0 {
+		return nil, fmt.Errorf("%w: burst is negative", ErrInvalidRateLimiter)
+	}
+	if burst == 0 {
+		burst = rate.Count
+	}
+	if client == nil {
+		return nil, fmt.Errorf("%w: client is nil", ErrInvalidRateLimiter)
+	}
+	config := NewRateLimitConfigBuilder().
+		RateLimitLabels(nil).
+		RateLimitTimeout(0).
+		RateLimitNoWait(false).
+		Build()
+	for _, f := range opt {
+		f(config)
+	}
+	return &RateLimiter{
+		namespace: namespace,
+		name:      name,
+		id:        id,
+		rate:      rate,
+		burst:     burst,
+		client:    client,
+		labels:    config.RateLimitLabels.Get(),
+		timeout:   config.RateLimitTimeout.Get(),
+		noWait:    config.RateLimitNoWait.Get(),
+	}, nil
+}
+
+// RateLimiter runs the function after taking a token from the bucket shared through the lease.
+//
+// The bucket is stored on the lease annotations and updated with optimistic concurrency.
+type RateLimiter struct {
+	namespace string
+	name      string
+	id        string
+	rate      Rate
+	burst     int
+	client    coordinationv1client.LeasesGetter
+	labels    labels.Set
+	timeout   time.Duration
+	noWait    bool
+}
+
+func (s *RateLimiter) String() string {
+	return fmt.Sprintf("namespace=%s name=%s id=%s rate=%s burst=%d", s.namespace, s.name, s.id, s.rate, s.burst)
+}
+
+func (s *RateLimiter) Logger(ctx context.Context) klog.Logger {
+	return logging.FromContext(ctx).WithValues(
+		"namespace", s.namespace,
+		"name", s.name,
+		"id", s.id,
+	)
+}
+
+func (s *RateLimiter) Labels() labels.Set {
+	if len(s.labels) == 0 {
+		return CommonLabels()
+	}
+	return labels.Merge(s.labels, CommonLabels())
+}
+
+// LockAndRun calls f after taking a token.
+//
+// Returns ErrRateLimited without invoking f if no token is available within the timeout,
+// or immediately with WithRateLimitNoWait.
+func (s *RateLimiter) LockAndRun(ctx context.Context, f func(context.Context) error) error {
+	if f == nil {
+		return fmt.Errorf("%w: f is nil", ErrInvalidRateLimiter)
+	}
+	if err := s.Wait(ctx); err != nil {
+		return err
+	}
+	return f(ctx)
+}
+
+// Wait blocks until a token is taken.
+func (s *RateLimiter) Wait(ctx context.Context) error {
+	logger := s.Logger(ctx)
+	var deadline time.Time
+	if s.timeout > 0 {
+		deadline = time.Now().Add(s.timeout)
+	}
+	for {
+		delay, err := s.Take(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: failed to take a token: %s", err, s)
+		}
+		if delay == 0 {
+			logger.V(1).Info("took a token")
+			return nil
+		}
+		if s.noWait {
+			return fmt.Errorf("%w: no token available: %s", ErrRateLimited, s)
+		}
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("%w: no token available within %s: %s", ErrRateLimited, s.timeout, s)
+		}
+		logger.V(1).Info("waiting a token", "delay", delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Take tries to take a token.
+// Returns 0 if a token is taken, otherwise the delay until a token becomes available.
+func (s *RateLimiter) Take(ctx context.Context) (time.Duration, error) {
+	var (
+		c     = s.client.Leases(s.namespace)
+		delay time.Duration
+	)
+	err := retry.OnError(rateLimitBackoff, func(err error) bool {
+		return k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)
+	}, func() error {
+		now := time.Now()
+		x, err := c.Get(ctx, s.name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			delay = 0
+			_, err := c.Create(ctx, &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   s.namespace,
+					Name:        s.name,
+					Labels:      s.Labels(),
+					Annotations: s.bucketAnnotations(float64(s.burst-1), now),
+				},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		tokens, at := s.refill(x.GetAnnotations(), now)
+		if tokens < 1 {
+			// at least 1ms not to be taken for a token by rounding
+			delay = max(time.Duration((1-tokens)/s.rate.perSecond()*float64(time.Second)), time.Millisecond)
+			return nil
+		}
+		delay = 0
+		x = x.DeepCopy()
+		if x.Annotations == nil {
+			x.Annotations = map[string]string{}
+		}
+		maps.Copy(x.Annotations, s.bucketAnnotations(tokens-1, at))
+		_, err = c.Update(ctx, x, metav1.UpdateOptions{})
+		return err
+	})
+	return delay, err
+}
+
+// refill returns the number of the tokens in the bucket at now, and the time to be recorded with them.
+//
+// The time is never moved backwards by the client whose clock is behind,
+// otherwise the next client would refill the elapsed time again.
+func (s *RateLimiter) refill(annotations map[string]string, now time.Time) (float64, time.Time) {
+	tokens, err := strconv.ParseFloat(annotations[AnnotationRateLimitTokens], 64)
+	if err != nil {
+		return float64(s.burst), now
+	}
+	last, err := time.Parse(time.RFC3339Nano, annotations[AnnotationRateLimitTime])
+	if err != nil {
+		return float64(s.burst), now
+	}
+	if elapsed := now.Sub(last); elapsed > 0 { // ignore the clock skew
+		tokens += elapsed.Seconds() * s.rate.perSecond()
+	}
+	return min(tokens, float64(s.burst)), maxTime(last, now)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func (s *RateLimiter) bucketAnnotations(tokens float64, now time.Time) map[string]string {
+	return map[string]string{
+		AnnotationRateLimitTokens: strconv.FormatFloat(tokens, 'f', -1, 64),
+		AnnotationRateLimitTime:   now.Format(time.RFC3339Nano),
+	}
+}
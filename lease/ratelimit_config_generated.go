@@ -0,0 +1,93 @@
+// Code generated by "goconfig -field RateLimitLabels labels.Set|RateLimitTimeout time.Duration|RateLimitNoWait bool -option -prefix RateLimit -output ratelimit_config_generated.go"; DO NOT EDIT.
+
+package lease
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type RateLimitConfigItem[T any] struct {
+	modified     bool
+	value        T
+	defaultValue T
+}
+
+func (s *RateLimitConfigItem[T]) Set(value T) {
+	s.modified = true
+	s.value = value
+}
+func (s *RateLimitConfigItem[T]) Get() T {
+	if s.modified {
+		return s.value
+	}
+	return s.defaultValue
+}
+func (s *RateLimitConfigItem[T]) Default() T {
+	return s.defaultValue
+}
+func (s *RateLimitConfigItem[T]) IsModified() bool {
+	return s.modified
+}
+func NewRateLimitConfigItem[T any](defaultValue T) *RateLimitConfigItem[T] {
+	return &RateLimitConfigItem[T]{
+		defaultValue: defaultValue,
+	}
+}
+
+type RateLimitConfig struct {
+	RateLimitLabels  *RateLimitConfigItem[labels.Set]
+	RateLimitTimeout *RateLimitConfigItem[time.Duration]
+	RateLimitNoWait  *RateLimitConfigItem[bool]
+}
+type RateLimitConfigBuilder struct {
+	rateLimitLabels  labels.Set
+	rateLimitTimeout time.Duration
+	rateLimitNoWait  bool
+}
+
+func (s *RateLimitConfigBuilder) RateLimitLabels(v labels.Set) *RateLimitConfigBuilder {
+	s.rateLimitLabels = v
+	return s
+}
+func (s *RateLimitConfigBuilder) RateLimitTimeout(v time.Duration) *RateLimitConfigBuilder {
+	s.rateLimitTimeout = v
+	return s
+}
+func (s *RateLimitConfigBuilder) RateLimitNoWait(v bool) *RateLimitConfigBuilder {
+	s.rateLimitNoWait = v
+	return s
+}
+func (s *RateLimitConfigBuilder) Build() *RateLimitConfig {
+	return &RateLimitConfig{
+		RateLimitLabels:  NewRateLimitConfigItem(s.rateLimitLabels),
+		RateLimitTimeout: NewRateLimitConfigItem(s.rateLimitTimeout),
+		RateLimitNoWait:  NewRateLimitConfigItem(s.rateLimitNoWait),
+	}
+}
+
+func NewRateLimitConfigBuilder() *RateLimitConfigBuilder { return &RateLimitConfigBuilder{} }
+func (s *RateLimitConfig) Apply(opt ...RateLimitConfigOption) {
+	for _, x := range opt {
+		x(s)
+	}
+}
+
+type RateLimitConfigOption func(*RateLimitConfig)
+
+func WithRateLimitLabels(v labels.Set) RateLimitConfigOption {
+	return func(c *RateLimitConfig) {
+		c.RateLimitLabels.Set(v)
+	}
+}
+func WithRateLimitTimeout(v time.Duration) RateLimitConfigOption {
+	return func(c *RateLimitConfig) {
+		c.RateLimitTimeout.Set(v)
+	}
+}
+func WithRateLimitNoWait(v bool) RateLimitConfigOption {
+	return func(c *RateLimitConfig) {
+		c.RateLimitNoWait.Set(v)
+	}
+}
@@ -0,0 +1,123 @@
+package lease_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("RateLimiter", func() {
+	DescribeTable("ParseRate",
+		func(s string, want lease.Rate, wantErr bool) {
+			got, err := lease.ParseRate(s)
+			if wantErr {
+				Expect(err).To(MatchError(lease.ErrInvalidRate))
+				return
+			}
+			Expect(err).To(Succeed())
+			Expect(got).To(Equal(want))
+		},
+		Entry("per minute", "10/m", lease.Rate{Count: 10, Per: time.Minute}, false),
+		Entry("per second", "1/s", lease.Rate{Count: 1, Per: time.Second}, false),
+		Entry("per duration", "3/30s", lease.Rate{Count: 3, Per: 30 * time.Second}, false),
+		Entry("no unit", "10", lease.Rate{}, true),
+		Entry("zero count", "0/m", lease.Rate{}, true),
+		Entry("unknown unit", "1/d", lease.Rate{}, true),
+	)
+
+	It("should reject when no token is available", func() {
+		const name = "ratelimit-reject"
+		limiter, err := lease.NewRateLimiter(namespace, name, name+"-id", lease.Rate{Count: 1, Per: time.Hour}, 2, clientIface,
+			lease.WithRateLimitNoWait(true),
+		)
+		Expect(err).To(Succeed())
+		for range 2 {
+			s := newSleeper(name, 0)
+			Expect(limiter.LockAndRun(ctx, s.sleep)).To(Succeed())
+			Expect(s.called).To(BeTrue())
+		}
+		s := newSleeper(name, 0)
+		Expect(limiter.LockAndRun(ctx, s.sleep)).To(MatchError(lease.ErrRateLimited))
+		Expect(s.called).To(BeFalse())
+	})
+
+	It("should wait for a token", func() {
+		const name = "ratelimit-wait"
+		limiter, err := lease.NewRateLimiter(namespace, name, name+"-id", lease.Rate{Count: 2, Per: time.Second}, 1, clientIface)
+		Expect(err).To(Succeed())
+		start := time.Now()
+		for range 3 {
+			Expect(limiter.Wait(ctx)).To(Succeed())
+		}
+		Expect(time.Since(start)).To(BeNumerically(">=", 900*time.Millisecond))
+	})
+
+	It("should time out", func() {
+		const name = "ratelimit-timeout"
+		limiter, err := lease.NewRateLimiter(namespace, name, name+"-id", lease.Rate{Count: 1, Per: time.Hour}, 1, clientIface,
+			lease.WithRateLimitTimeout(time.Second),
+		)
+		Expect(err).To(Succeed())
+		Expect(limiter.Wait(ctx)).To(Succeed())
+		Expect(limiter.Wait(ctx)).To(MatchError(lease.ErrRateLimited))
+	})
+
+	It("should not move the time of the bucket backwards", func() {
+		const name = "ratelimit-clock-skew"
+		limiter, err := lease.NewRateLimiter(namespace, name, name+"-id", lease.Rate{Count: 1, Per: time.Hour}, 3, clientIface,
+			lease.WithRateLimitNoWait(true),
+		)
+		Expect(err).To(Succeed())
+		Expect(limiter.Wait(ctx)).To(Succeed())
+		// recorded by the client whose clock is ahead
+		ahead := time.Now().Add(time.Hour).Format(time.RFC3339Nano)
+		c := clientIface.Leases(namespace)
+		x, err := c.Get(ctx, name, metav1.GetOptions{})
+		Expect(err).To(Succeed())
+		x.Annotations[lease.AnnotationRateLimitTime] = ahead
+		_, err = c.Update(ctx, x, metav1.UpdateOptions{})
+		Expect(err).To(Succeed())
+
+		Expect(limiter.Wait(ctx)).To(Succeed())
+		x, err = c.Get(ctx, name, metav1.GetOptions{})
+		Expect(err).To(Succeed())
+		Expect(x.Annotations).To(HaveKeyWithValue(lease.AnnotationRateLimitTime, ahead))
+		Expect(x.Annotations).To(HaveKeyWithValue(lease.AnnotationRateLimitTokens, "1"))
+	})
+
+	It("should share the tokens among the clients", func() {
+		const (
+			name    = "ratelimit-share"
+			clients = 5
+			burst   = 3
+		)
+		var (
+			wg    sync.WaitGroup
+			taken atomic.Int32
+		)
+		for i := range clients {
+			limiter, err := lease.NewRateLimiter(namespace, name, fmt.Sprintf("%s-%d", name, i), lease.Rate{Count: 1, Per: time.Hour}, burst, clientIface,
+				lease.WithRateLimitNoWait(true),
+			)
+			Expect(err).To(Succeed())
+			wg.Go(func() {
+				if limiter.Wait(ctx) == nil {
+					taken.Add(1)
+				}
+			})
+		}
+		wg.Wait()
+		Expect(taken.Load()).To(Equal(int32(burst)))
+	})
+
+	It("should reject invalid name", func() {
+		_, err := lease.NewRateLimiter(namespace, "some_api", "id", lease.Rate{Count: 1, Per: time.Second}, 0, clientIface)
+		Expect(err).To(MatchError(lease.ErrInvalidRateLimiter))
+	})
+})
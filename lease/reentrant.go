@@ -0,0 +1,133 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// errNotHeld means the lease is not held by the id, so it cannot be reentered.
+var errNotHeld = errors.New("NotHeld")
+
+// heldBy returns true if the lease is held by the id and has not expired.
+func heldBy(x *coordinationv1.Lease, id string, now time.Time) bool {
+	spec := x.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity != id {
+		return false
+	}
+	return !expired(x, now)
+}
+
+// expired returns true if the lease has not been renewed within its duration.
+func expired(x *coordinationv1.Lease, now time.Time) bool {
+	spec := x.Spec
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return !spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second).After(now)
+}
+
+// reentrantDepth returns the nesting counter on the lease.
+func reentrantDepth(x *coordinationv1.Lease) int {
+	v, _ := strconv.Atoi(x.GetAnnotations()[AnnotationReentrantDepth])
+	return max(v, 0)
+}
+
+// addReentrantDepth adds delta to the nesting counter on the lease if it is held by the locker.
+// Returns the new counter.
+func (s *Locker) addReentrantDepth(ctx context.Context, delta int) (int, error) {
+	var (
+		c     = s.client.Leases(s.namespace)
+		depth int
+	)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		x, err := c.Get(ctx, s.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !heldBy(x, s.id, time.Now()) {
+			return errNotHeld
+		}
+		depth = max(reentrantDepth(x)+delta, 0)
+		x = x.DeepCopy()
+		if x.Annotations == nil {
+			x.Annotations = map[string]string{}
+		}
+		x.Annotations[AnnotationReentrantDepth] = strconv.Itoa(depth)
+		_, err = c.Update(ctx, x, metav1.UpdateOptions{})
+		return err
+	})
+	return depth, err
+}
+
+// reenter calls f without the leader election if the lease is already held by the same id.
+// Returns false if the lease is not held by the id, then the caller should acquire the lease.
+//
+// f is canceled if the lease is no longer held by the id, e.g. the outermost holder exited.
+func (s *Locker) reenter(ctx context.Context, f func(context.Context) error) (bool, error) {
+	logger := s.Logger(ctx)
+	depth, err := s.addReentrantDepth(ctx, 1)
+	switch {
+	case errors.Is(err, errNotHeld) || k8serrors.IsNotFound(err):
+		return false, nil
+	case err != nil:
+		return true, fmt.Errorf("%w: failed to reenter the lease", err)
+	}
+	logger.V(0).Info("reentered the lease", "depth", depth)
+
+	parentCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lostC := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.retryPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			x, err := s.client.Leases(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+			if ctx.Err() != nil {
+				return
+			}
+			if k8serrors.IsNotFound(err) || (err == nil && !heldBy(x, s.id, time.Now())) {
+				logger.V(0).Info("the reentered lease is no longer held")
+				close(lostC)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	err = f(ctx)
+	select {
+	case <-lostC:
+		if parentCtx.Err() == nil {
+			err = errors.Join(ErrLeaderLost, err)
+		}
+		return true, err
+	default:
+	}
+	cancel()
+
+	leaveCtx, leaveCancel := context.WithTimeout(context.WithoutCancel(parentCtx), cleanupTimeout)
+	defer leaveCancel()
+	depth, leaveErr := s.addReentrantDepth(leaveCtx, -1)
+	switch {
+	case leaveErr == nil:
+		logger.V(1).Info("left the reentered lease", "depth", depth)
+	case errors.Is(leaveErr, errNotHeld):
+	default:
+		err = errors.Join(err, fmt.Errorf("%w: failed to leave the reentered lease", leaveErr))
+	}
+	return true, err
+}
@@ -0,0 +1,126 @@
+package lease
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// renewMonitor tracks how long it has been since the lease was written successfully,
+// so that a hung request is also counted as failing.
+type renewMonitor struct {
+	mux         sync.Mutex
+	lastSuccess time.Time
+}
+
+// observe records the result of a request that writes the lease.
+func (m *renewMonitor) observe(err error) {
+	if err != nil {
+		return
+	}
+	m.reset()
+}
+
+// reset records the success at now.
+func (m *renewMonitor) reset() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.lastSuccess = time.Now()
+}
+
+// sinceLastSuccess returns the duration since the last successful renewal.
+func (m *renewMonitor) sinceLastSuccess() time.Duration {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.lastSuccess.IsZero() {
+		return 0
+	}
+	return time.Since(m.lastSuccess)
+}
+
+// warn notifies warner once the lease has not been renewed for threshold,
+// and rearms it after the lease is renewed again.
+func (m *renewMonitor) warn(ctx context.Context, logger klog.Logger, threshold, interval time.Duration, warner *renewWarner) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d := m.sinceLastSuccess()
+			switch {
+			case d >= threshold && warner.notify():
+				logger.V(0).Info("lease has not been renewed", "duration", d, "threshold", threshold)
+			case d < threshold && warner.rearm():
+				logger.V(1).Info("lease has been renewed again")
+			}
+		}
+	}
+}
+
+// renewWarner holds the channel closed on the renew warning.
+// The channel is replaced after the lease is renewed again, so that the later runs are not warned by the past one.
+type renewWarner struct {
+	mux      sync.Mutex
+	warnC    chan struct{}
+	notified bool
+}
+
+func newRenewWarner() *renewWarner {
+	return &renewWarner{
+		warnC: make(chan struct{}),
+	}
+}
+
+// channel returns the current channel.
+func (w *renewWarner) channel() <-chan struct{} {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.warnC
+}
+
+// notify closes the current channel; returns false if already closed.
+func (w *renewWarner) notify() bool {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.notified {
+		return false
+	}
+	w.notified = true
+	close(w.warnC)
+	return true
+}
+
+// rearm replaces the closed channel with a new one; returns false if not closed.
+func (w *renewWarner) rearm() bool {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if !w.notified {
+		return false
+	}
+	w.notified = false
+	w.warnC = make(chan struct{})
+	return true
+}
+
+type renewWarningKey struct{}
+
+func withRenewWarning(ctx context.Context, warner *renewWarner) context.Context {
+	return context.WithValue(ctx, renewWarningKey{}, warner)
+}
+
+// RenewWarning returns the channel that is closed once the lease has not been renewed,
+// by failing or hanging requests, for RetryPeriod plus the fraction of RenewDeadline
+// given by WithRenewWarningFraction, that is, before the leadership is lost.
+// After the lease is renewed again, a new channel is returned, so get it for each run within the hold.
+//
+// It is available in the context passed to the function of LockAndRun; nil otherwise.
+func RenewWarning(ctx context.Context) <-chan struct{} {
+	if x, ok := ctx.Value(renewWarningKey{}).(*renewWarner); ok {
+		return x.channel()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/klog/v2"
+)
+
+// ShardIndex returns the shard of the key in [0, shards) by the jump consistent hash,
+// so that few keys move when the number of the shards changes.
+func ShardIndex(key string, shards int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	var (
+		k          = h.Sum64()
+		b, j int64 = -1, 0
+	)
+	for j < int64(shards) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
+
+// ShardName returns the name of the lease of the shard.
+func ShardName(name string, index int) string {
+	return fmt.Sprintf("%s-shard-%d", name, index)
+}
+
+// NewShardedLocker creates the new Locker of the key on one of the fixed leases `<name>-shard-0..shards-1`.
+//
+// The keys on the same shard exclude each other, that is, false contention;
+// it is logged with the key holding the shard.
+// See NewLocker for the other arguments and the options.
+func NewShardedLocker(
+	namespace, name, key, id string,
+	shards int,
+	client coordinationv1client.LeasesGetter,
+	opt ...ConfigOption,
+) (*Locker, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%w: shard key is empty", ErrInvalidLocker)
+	}
+	if shards < 1 {
+		return nil, fmt.Errorf("%w: shards should be positive: %d", ErrInvalidLocker, shards)
+	}
+	locker, err := NewLocker(namespace, ShardName(name, ShardIndex(key, shards)), id, client, opt...)
+	if err != nil {
+		return nil, err
+	}
+	// annotated on the lease to log false contention
+	locker.shardKey = key
+	return locker, nil
+}
+
+// logShardContention logs whether the shard is held for the same key or another one.
+func (s *Locker) logShardContention(ctx context.Context, logger klog.Logger, holder string) {
+	x, err := s.client.Leases(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	heldKey := x.GetAnnotations()[AnnotationShardKey]
+	if heldKey == s.shardKey {
+		logger.V(1).Info("shard held for the same key", "id", holder, "key", s.shardKey)
+		return
+	}
+	logger.V(0).Info("false contention: shard held for another key", "id", holder, "key", s.shardKey, "heldKey", heldKey)
+}
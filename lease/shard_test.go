@@ -0,0 +1,64 @@
+package lease_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Shard", func() {
+	It("should map the keys to the shards stably", func() {
+		const shards = 8
+		for i := range 100 {
+			key := fmt.Sprintf("key-%d", i)
+			index := lease.ShardIndex(key, shards)
+			Expect(index).To(And(BeNumerically(">=", 0), BeNumerically("<", shards)), key)
+			Expect(lease.ShardIndex(key, shards)).To(Equal(index), key)
+		}
+		Expect(lease.ShardIndex("key", 1)).To(Equal(0))
+	})
+
+	It("should exclude the keys on the same shard", func() {
+		const (
+			name   = "sharded"
+			shards = 2
+		)
+		var keys []string
+		for i := 0; len(keys) < 2; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			if lease.ShardIndex(key, shards) == 0 {
+				keys = append(keys, key)
+			}
+		}
+		first, err := lease.NewShardedLocker(namespace, name, keys[0], name+"-first", shards, clientIface)
+		Expect(err).To(Succeed())
+		Expect(first.Name()).To(Equal(lease.ShardName(name, 0)))
+		second, err := lease.NewShardedLocker(namespace, name, keys[1], name+"-second", shards, clientIface,
+			lease.WithLeaderElectTimeout(time.Second),
+		)
+		Expect(err).To(Succeed())
+		Expect(second.Name()).To(Equal(first.Name()))
+
+		var secondErr error
+		Expect(first.LockAndRun(ctx, func(_ context.Context) error {
+			x, err := clientIface.Leases(namespace).Get(ctx, first.Name(), metav1.GetOptions{})
+			Expect(err).To(Succeed())
+			Expect(x.GetAnnotations()).To(HaveKeyWithValue(lease.AnnotationShardKey, keys[0]))
+			secondErr = second.LockAndRun(ctx, newSleeper(name, 0).sleep)
+			return nil
+		})).To(Succeed())
+		Expect(secondErr).To(MatchError(lease.ErrElectTimedOut))
+	})
+
+	It("should reject the invalid arguments", func() {
+		_, err := lease.NewShardedLocker(namespace, "sharded-invalid", "", "id", 2, clientIface)
+		Expect(err).To(MatchError(lease.ErrInvalidLocker))
+		_, err = lease.NewShardedLocker(namespace, "sharded-invalid", "key", "id", 0, clientIface)
+		Expect(err).To(MatchError(lease.ErrInvalidLocker))
+	})
+})
@@ -0,0 +1,108 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// Status is the state of a lease.
+type Status struct {
+	Namespace        string
+	Name             string
+	HolderIdentity   string
+	AcquireTime      time.Time
+	RenewTime        time.Time
+	LeaseDuration    time.Duration
+	LeaseTransitions int32
+	// LastRun is nil if no runs are recorded.
+	LastRun *LastRun
+	// ScheduledTime is the last scheduled time recorded by WithScheduledTime; zero if not recorded.
+	ScheduledTime time.Time
+}
+
+// GetStatus returns the state of the lease.
+func GetStatus(ctx context.Context, client coordinationv1client.LeasesGetter, namespace, name string) (*Status, error) {
+	x, err := client.Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	s := &Status{
+		Namespace: namespace,
+		Name:      name,
+		LastRun:   lastRunFromAnnotations(x.GetAnnotations()),
+	}
+	if v, ok := x.GetAnnotations()[AnnotationScheduledTime]; ok {
+		s.ScheduledTime, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := x.Spec.HolderIdentity; v != nil {
+		s.HolderIdentity = *v
+	}
+	if v := x.Spec.AcquireTime; v != nil {
+		s.AcquireTime = v.Time
+	}
+	if v := x.Spec.RenewTime; v != nil {
+		s.RenewTime = v.Time
+	}
+	if v := x.Spec.LeaseDurationSeconds; v != nil {
+		s.LeaseDuration = time.Duration(*v) * time.Second
+	}
+	if v := x.Spec.LeaseTransitions; v != nil {
+		s.LeaseTransitions = *v
+	}
+	return s, nil
+}
+
+// Status returns the state of the lease of the locker.
+func (s *Locker) Status(ctx context.Context) (*Status, error) {
+	return GetStatus(ctx, s.client, s.namespace, s.name)
+}
+
+// Held returns true if the lease is held by someone at now.
+func (s *Status) Held(now time.Time) bool {
+	return s.HolderIdentity != "" && s.RenewTime.Add(s.LeaseDuration).After(now)
+}
+
+// Write writes the human-readable state to w.
+func (s *Status) Write(w io.Writer) error {
+	var (
+		formatTime = func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.Format(time.RFC3339)
+		}
+		lines = []string{
+			fmt.Sprintf("namespace: %s", s.Namespace),
+			fmt.Sprintf("name: %s", s.Name),
+			fmt.Sprintf("holder: %s", s.HolderIdentity),
+			fmt.Sprintf("held: %t", s.Held(time.Now())),
+			fmt.Sprintf("acquire time: %s", formatTime(s.AcquireTime)),
+			fmt.Sprintf("renew time: %s", formatTime(s.RenewTime)),
+			fmt.Sprintf("lease duration: %s", s.LeaseDuration),
+			fmt.Sprintf("lease transitions: %d", s.LeaseTransitions),
+		}
+	)
+	if r := s.LastRun; r != nil {
+		lines = append(lines,
+			fmt.Sprintf("last run start: %s", formatTime(r.StartTime)),
+			fmt.Sprintf("last run end: %s", formatTime(r.EndTime)),
+			fmt.Sprintf("last exit code: %d", r.ExitCode),
+			fmt.Sprintf("last holder: %s", r.Holder),
+			fmt.Sprintf("last success time: %s", formatTime(r.SuccessTime)),
+		)
+	}
+	if !s.ScheduledTime.IsZero() {
+		lines = append(lines, fmt.Sprintf("scheduled time: %s", formatTime(s.ScheduledTime)))
+	}
+	for _, x := range lines {
+		if _, err := fmt.Fprintln(w, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
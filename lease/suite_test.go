@@ -73,7 +73,7 @@ var _ = BeforeSuite(func() {
 	By("setup loggers")
 	logf.SetLogger(klog.TODO())
 	By("setup clients")
-	cfg, err := kconfig.Build("")
+	cfg, _, err := kconfig.Build(&kconfig.Options{})
 	Expect(err).To(Succeed())
 	Expect(cfg).NotTo(BeNil())
 	// relax ratelimit due to testing
@@ -0,0 +1,188 @@
+package lease
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/berquerant/k8s-lease/logging"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/klog/v2"
+)
+
+var (
+	ErrInvalidWorkQueue = errors.New("InvalidWorkQueue")
+	ErrWorkFailed       = errors.New("WorkFailed")
+)
+
+// workCompletedKey is the key of Once recording the completion of an item.
+const workCompletedKey = "work-completed"
+
+//go:generate go tool goconfig -field "WorkQueueLabels labels.Set|WorkQueueLeaseDuration time.Duration|WorkQueueRenewDeadline time.Duration|WorkQueueRetryPeriod time.Duration" -option -prefix WorkQueue -output workqueue_config_generated.go
+
+// NewWorkQueue creates the new WorkQueue instance.
+//
+//   - namespace: the namespace of the leases
+//   - name: the name of the queue, the prefix of the leases; it should make the lease names DNS-1123 subdomains
+//   - id: the id of the worker
+//   - items: the work items
+//   - client: the leases client
+//
+// Available options:
+//
+//   - WithWorkQueueLabels: the additional labels of the leases
+//   - WithWorkQueueLeaseDuration: the total time a worker holds the claim before it expires (default: 15 seconds)
+//   - WithWorkQueueRenewDeadline: the time limit for the worker to successfully renew its claim (default: 10 seconds)
+//   - WithWorkQueueRetryPeriod: the time interval between each attempt to claim or renew, and between each pass over the items (default: 2 seconds)
+func NewWorkQueue(
+	namespace, name, id string,
+	items []string,
+	client coordinationv1client.LeasesGetter,
+	opt ...WorkQueueConfigOption,
+) (*WorkQueue, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("%w: namespace is empty", ErrInvalidWorkQueue)
+	}
+	// the completion of the item is recorded on the longest lease name
+	if errs := validation.IsDNS1123Subdomain(workLeaseName(name, "") + onceSuffix); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: invalid name %q: %v", ErrInvalidWorkQueue, name, errs)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is empty", ErrInvalidWorkQueue)
+	}
+	if client == nil {
+		return nil, fmt.Errorf("%w: client is nil", ErrInvalidWorkQueue)
+	}
+	config := NewWorkQueueConfigBuilder().
+		WorkQueueLabels(nil).
+		WorkQueueLeaseDuration(DefaultLeaseDuration).
+		WorkQueueRenewDeadline(DefaultRenewDeadline).
+		WorkQueueRetryPeriod(DefaultRetryPeriod).
+		Build()
+	for _, f := range opt {
+		f(config)
+	}
+	return &WorkQueue{
+		namespace:     namespace,
+		name:          name,
+		id:            id,
+		items:         items,
+		client:        client,
+		labels:        config.WorkQueueLabels.Get(),
+		leaseDuration: config.WorkQueueLeaseDuration.Get(),
+		renewDeadline: config.WorkQueueRenewDeadline.Get(),
+		retryPeriod:   config.WorkQueueRetryPeriod.Get(),
+	}, nil
+}
+
+// WorkQueue shares the static work items among the workers.
+//
+// Each item is claimed by the lease named `<name>-<hash of item>`,
+// which is renewed while the item is processed and reclaimed by another worker if expired.
+// The completion of the item is recorded by Once so that it is never claimed again.
+type WorkQueue struct {
+	namespace                                 string
+	name                                      string
+	id                                        string
+	items                                     []string
+	client                                    coordinationv1client.LeasesGetter
+	labels                                    labels.Set
+	leaseDuration, renewDeadline, retryPeriod time.Duration
+}
+
+func (q *WorkQueue) String() string {
+	return fmt.Sprintf("namespace=%s queue=%s id=%s", q.namespace, q.name, q.id)
+}
+
+func (q *WorkQueue) Logger(ctx context.Context) klog.Logger {
+	return logging.FromContext(ctx).WithValues(
+		"namespace", q.namespace,
+		"queue", q.name,
+		"id", q.id,
+	)
+}
+
+// LeaseName returns the name of the lease of the item.
+func (q *WorkQueue) LeaseName(item string) string { return workLeaseName(q.name, item) }
+
+func workLeaseName(name, item string) string {
+	sum := sha256.Sum256([]byte(item))
+	return fmt.Sprintf("%s-%x", name, sum[:5])
+}
+
+func (q *WorkQueue) once(item string) (*Once, error) {
+	locker, err := NewLocker(q.namespace, q.LeaseName(item), q.id, q.client,
+		WithLabels(q.labels),
+		WithLeaseDuration(q.leaseDuration),
+		WithRenewDeadline(q.renewDeadline),
+		WithRetryPeriod(q.retryPeriod),
+		// the first attempt to claim is made immediately
+		WithLeaderElectTimeout(q.retryPeriod),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return NewOnce(locker, workCompletedKey, false)
+}
+
+// Run claims the items one by one and calls f with the claimed item until all the items are completed.
+//
+// The items claimed by the other workers are tried again in the next pass.
+// The items f failed are not tried again by this worker; Run returns ErrWorkFailed with them at the end.
+func (q *WorkQueue) Run(ctx context.Context, f func(ctx context.Context, item string) error) error {
+	if f == nil {
+		return fmt.Errorf("%w: f is nil", ErrInvalidWorkQueue)
+	}
+	var (
+		logger  = q.Logger(ctx)
+		pending = q.items
+		errs    []error
+	)
+	for pass := 1; len(pending) > 0; pass++ {
+		logger.V(1).Info("work pass", "pass", pass, "pending", len(pending))
+		var heldElsewhere []string
+		for _, item := range pending {
+			if err := ctx.Err(); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			once, err := q.once(item)
+			if err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			if _, completed, err := once.Completed(ctx); err == nil && completed {
+				continue
+			}
+			err = once.LockAndRun(ctx, func(ctx context.Context) error {
+				logger.V(0).Info("work claimed", "item", item)
+				return f(ctx, item)
+			})
+			switch {
+			case err == nil:
+				logger.V(0).Info("work completed", "item", item)
+			case errors.Is(err, ErrSkipped):
+				// completed by another worker
+			case errors.Is(err, ErrElectTimedOut):
+				heldElsewhere = append(heldElsewhere, item)
+			case ctx.Err() != nil:
+				return errors.Join(append(errs, err)...)
+			default:
+				logger.Error(err, "work failed", "item", item)
+				errs = append(errs, fmt.Errorf("%w: item=%s: %w", ErrWorkFailed, item, err))
+			}
+		}
+		pending = heldElsewhere
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(append(errs, ctx.Err())...)
+		case <-time.After(q.retryPeriod):
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+// Code generated by "goconfig -field WorkQueueLabels labels.Set|WorkQueueLeaseDuration time.Duration|WorkQueueRenewDeadline time.Duration|WorkQueueRetryPeriod time.Duration -option -prefix WorkQueue -output workqueue_config_generated.go"; DO NOT EDIT.
+
+package lease
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type WorkQueueConfigItem[T any] struct {
+	modified     bool
+	value        T
+	defaultValue T
+}
+
+func (s *WorkQueueConfigItem[T]) Set(value T) {
+	s.modified = true
+	s.value = value
+}
+func (s *WorkQueueConfigItem[T]) Get() T {
+	if s.modified {
+		return s.value
+	}
+	return s.defaultValue
+}
+func (s *WorkQueueConfigItem[T]) Default() T {
+	return s.defaultValue
+}
+func (s *WorkQueueConfigItem[T]) IsModified() bool {
+	return s.modified
+}
+func NewWorkQueueConfigItem[T any](defaultValue T) *WorkQueueConfigItem[T] {
+	return &WorkQueueConfigItem[T]{
+		defaultValue: defaultValue,
+	}
+}
+
+type WorkQueueConfig struct {
+	WorkQueueLabels        *WorkQueueConfigItem[labels.Set]
+	WorkQueueLeaseDuration *WorkQueueConfigItem[time.Duration]
+	WorkQueueRenewDeadline *WorkQueueConfigItem[time.Duration]
+	WorkQueueRetryPeriod   *WorkQueueConfigItem[time.Duration]
+}
+type WorkQueueConfigBuilder struct {
+	workQueueLabels        labels.Set
+	workQueueLeaseDuration time.Duration
+	workQueueRenewDeadline time.Duration
+	workQueueRetryPeriod   time.Duration
+}
+
+func (s *WorkQueueConfigBuilder) WorkQueueLabels(v labels.Set) *WorkQueueConfigBuilder {
+	s.workQueueLabels = v
+	return s
+}
+func (s *WorkQueueConfigBuilder) WorkQueueLeaseDuration(v time.Duration) *WorkQueueConfigBuilder {
+	s.workQueueLeaseDuration = v
+	return s
+}
+func (s *WorkQueueConfigBuilder) WorkQueueRenewDeadline(v time.Duration) *WorkQueueConfigBuilder {
+	s.workQueueRenewDeadline = v
+	return s
+}
+func (s *WorkQueueConfigBuilder) WorkQueueRetryPeriod(v time.Duration) *WorkQueueConfigBuilder {
+	s.workQueueRetryPeriod = v
+	return s
+}
+func (s *WorkQueueConfigBuilder) Build() *WorkQueueConfig {
+	return &WorkQueueConfig{
+		WorkQueueLabels:        NewWorkQueueConfigItem(s.workQueueLabels),
+		WorkQueueLeaseDuration: NewWorkQueueConfigItem(s.workQueueLeaseDuration),
+		WorkQueueRenewDeadline: NewWorkQueueConfigItem(s.workQueueRenewDeadline),
+		WorkQueueRetryPeriod:   NewWorkQueueConfigItem(s.workQueueRetryPeriod),
+	}
+}
+
+func NewWorkQueueConfigBuilder() *WorkQueueConfigBuilder { return &WorkQueueConfigBuilder{} }
+func (s *WorkQueueConfig) Apply(opt ...WorkQueueConfigOption) {
+	for _, x := range opt {
+		x(s)
+	}
+}
+
+type WorkQueueConfigOption func(*WorkQueueConfig)
+
+func WithWorkQueueLabels(v labels.Set) WorkQueueConfigOption {
+	return func(c *WorkQueueConfig) {
+		c.WorkQueueLabels.Set(v)
+	}
+}
+func WithWorkQueueLeaseDuration(v time.Duration) WorkQueueConfigOption {
+	return func(c *WorkQueueConfig) {
+		c.WorkQueueLeaseDuration.Set(v)
+	}
+}
+func WithWorkQueueRenewDeadline(v time.Duration) WorkQueueConfigOption {
+	return func(c *WorkQueueConfig) {
+		c.WorkQueueRenewDeadline.Set(v)
+	}
+}
+func WithWorkQueueRetryPeriod(v time.Duration) WorkQueueConfigOption {
+	return func(c *WorkQueueConfig) {
+		c.WorkQueueRetryPeriod.Set(v)
+	}
+}
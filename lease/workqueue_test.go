@@ -0,0 +1,85 @@
+package lease_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WorkQueue", func() {
+	It("should process each item once", func() {
+		const (
+			name    = "workqueue"
+			workers = 3
+		)
+		var (
+			items = []string{"a", "b", "c", "d", "e", "f"}
+			wg    sync.WaitGroup
+			mux   sync.Mutex
+			count = map[string]int{}
+			errs  = make([]error, workers)
+		)
+		for i := range workers {
+			queue, err := lease.NewWorkQueue(namespace, name, fmt.Sprintf("%s-%d", name, i), items, clientIface,
+				lease.WithWorkQueueRetryPeriod(200*time.Millisecond),
+			)
+			Expect(err).To(Succeed())
+			wg.Go(func() {
+				errs[i] = queue.Run(ctx, func(_ context.Context, item string) error {
+					mux.Lock()
+					count[item]++
+					mux.Unlock()
+					time.Sleep(100 * time.Millisecond)
+					return nil
+				})
+			})
+		}
+		wg.Wait()
+		for _, err := range errs {
+			Expect(err).To(Succeed())
+		}
+		for _, item := range items {
+			Expect(count[item]).To(Equal(1), item)
+		}
+
+		By("completed items are never claimed again")
+		queue, err := lease.NewWorkQueue(namespace, name, name+"-late", items, clientIface)
+		Expect(err).To(Succeed())
+		var called bool
+		Expect(queue.Run(ctx, func(context.Context, string) error {
+			called = true
+			return nil
+		})).To(Succeed())
+		Expect(called).To(BeFalse())
+	})
+
+	It("should report the failed items", func() {
+		const name = "workqueue-failed"
+		queue, err := lease.NewWorkQueue(namespace, name, name+"-id", []string{"ok", "ng"}, clientIface)
+		Expect(err).To(Succeed())
+		Expect(queue.Run(ctx, func(_ context.Context, item string) error {
+			if item == "ng" {
+				return errors.New("failure")
+			}
+			return nil
+		})).To(MatchError(lease.ErrWorkFailed))
+
+		var processed []string
+		Expect(queue.Run(ctx, func(_ context.Context, item string) error {
+			processed = append(processed, item)
+			return nil
+		})).To(Succeed())
+		Expect(processed).To(Equal([]string{"ng"}))
+	})
+
+	It("should reject invalid name", func() {
+		_, err := lease.NewWorkQueue(namespace, "some_job", "id", []string{"a"}, clientIface)
+		Expect(err).To(MatchError(lease.ErrInvalidWorkQueue))
+	})
+})
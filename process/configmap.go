@@ -0,0 +1,97 @@
+package process
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// Data returns the report as the data of a ConfigMap.
+func (r Report) Data() map[string]string {
+	d := map[string]string{
+		"command":   strings.Join(r.Args, " "),
+		"attempts":  strconv.Itoa(r.Attempts),
+		"exit-code": strconv.Itoa(r.ExitCode),
+	}
+	if r.Signal != nil {
+		d["signal"] = SignalIntoString(r.Signal)
+		d["signal-sent"] = strconv.FormatBool(r.SignalSent)
+	}
+	if !r.StartTime.IsZero() {
+		d["start-time"] = r.StartTime.Format(time.RFC3339)
+		d["end-time"] = r.EndTime.Format(time.RFC3339)
+		d["elapsed"] = r.Elapsed().String()
+	}
+	return d
+}
+
+// OutputConfigMap is the ConfigMap that keeps the result of the last run for postmortems.
+type OutputConfigMap struct {
+	Client    corev1client.ConfigMapsGetter
+	Namespace string
+	Name      string
+	Labels    labels.Set
+}
+
+// MaxOutputBytes is the maximum size of the output saved to the ConfigMap,
+// well below the 1MiB limit of the size of a ConfigMap.
+const MaxOutputBytes = 512 * 1024
+
+// Save creates or overwrites the ConfigMap with the report, the last lines of the output and extra data.
+//
+// Only the tail of the output within MaxOutputBytes is saved.
+func (c *OutputConfigMap) Save(ctx context.Context, report Report, lines []string, extra map[string]string) error {
+	data := report.Data()
+	data["output"] = tailOutput(strings.Join(lines, "\n"), MaxOutputBytes)
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	client := c.Client.ConfigMaps(c.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		x, err := client.Get(ctx, c.Name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			_, err := client.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: c.Namespace,
+					Name:      c.Name,
+					Labels:    c.Labels,
+				},
+				Data: data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		x.Labels = labels.Merge(x.Labels, c.Labels)
+		x.Data = data
+		_, err = client.Update(ctx, x, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// tailOutput returns the tail of s within maxBytes, cut at a line boundary if possible.
+func tailOutput(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	s = s[len(s)-maxBytes:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	// a single long line, cut at a rune boundary
+	for len(s) > 0 && !utf8.RuneStart(s[0]) {
+		s = s[1:]
+	}
+	return s
+}
@@ -0,0 +1,62 @@
+package process_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOutputConfigMap(t *testing.T) {
+	longLine := strings.Repeat("x", process.MaxOutputBytes)
+	for _, tc := range []struct {
+		title string
+		lines []string
+		want  string
+	}{
+		{
+			title: "within limit",
+			lines: []string{"a", "b"},
+			want:  "a\nb",
+		},
+		{
+			title: "keep the tail lines",
+			lines: []string{"head", longLine[:process.MaxOutputBytes-9], "tail"},
+			want:  longLine[:process.MaxOutputBytes-9] + "\ntail",
+		},
+		{
+			title: "cut the long line",
+			lines: []string{"head", longLine + "tail"},
+			want:  longLine[4:] + "tail",
+		},
+		{
+			title: "cut at the rune boundary",
+			lines: []string{"あ" + longLine[:process.MaxOutputBytes-1]},
+			want:  longLine[:process.MaxOutputBytes-1],
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			client := fake.NewClientset().CoreV1()
+			c := &process.OutputConfigMap{
+				Client:    client,
+				Namespace: "default",
+				Name:      "output",
+			}
+			ctx := context.Background()
+			if !assert.Nil(t, c.Save(ctx, process.Report{}, tc.lines, nil)) {
+				return
+			}
+			x, err := client.ConfigMaps("default").Get(ctx, "output", metav1.GetOptions{})
+			if !assert.Nil(t, err) {
+				return
+			}
+			got := x.Data["output"]
+			assert.LessOrEqual(t, len(got), process.MaxOutputBytes)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// HeartbeatMode is the way the command sends heartbeats to klock.
+type HeartbeatMode string
+
+const (
+	// HeartbeatFile expects the command to touch the file at $KLOCK_HEARTBEAT_FILE.
+	HeartbeatFile HeartbeatMode = "file"
+	// HeartbeatFD expects the command to write to the file descriptor $KLOCK_HEARTBEAT_FD.
+	HeartbeatFD HeartbeatMode = "fd"
+	// HeartbeatSocket expects the command to write to the unix socket $KLOCK_HEARTBEAT_SOCKET.
+	HeartbeatSocket HeartbeatMode = "socket"
+)
+
+const (
+	EnvHeartbeatFile   = "KLOCK_HEARTBEAT_FILE"
+	EnvHeartbeatFD     = "KLOCK_HEARTBEAT_FD"
+	EnvHeartbeatSocket = "KLOCK_HEARTBEAT_SOCKET"
+)
+
+var ErrHeartbeatTimeout = errors.New("HeartbeatTimeout")
+
+// HeartbeatKillAfter is the delay before killing the command missing heartbeats
+// if Process.WaitDelay is 0.
+const HeartbeatKillAfter = 10 * time.Second
+
+// Heartbeat is the watchdog of the command.
+// If the command misses heartbeats for Timeout, the lock is released,
+// and the command is stopped in the same way as on cancel,
+// then killed after Process.WaitDelay, or HeartbeatKillAfter if it is 0.
+// The command is never restarted nor retried.
+type Heartbeat struct {
+	Mode HeartbeatMode
+	// Path is the heartbeat file or socket path.
+	// A temporary path is used if empty.
+	Path    string
+	Timeout time.Duration
+}
+
+func (h *Heartbeat) validate() error {
+	if h == nil {
+		return nil
+	}
+	if h.Timeout <= 0 {
+		return fmt.Errorf("%w: heartbeat timeout should be positive", ErrInvalidProcess)
+	}
+	switch h.Mode {
+	case HeartbeatFile, HeartbeatFD, HeartbeatSocket:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown heartbeat mode: %s", ErrInvalidProcess, h.Mode)
+	}
+}
+
+// heartbeatWatcher receives heartbeats from the command.
+type heartbeatWatcher struct {
+	beatC chan struct{}
+	// onStarted is called after the command started.
+	onStarted func()
+	closers   []func() error
+}
+
+func newHeartbeatWatcher() *heartbeatWatcher {
+	return &heartbeatWatcher{
+		beatC:     make(chan struct{}, 1),
+		onStarted: func() {},
+	}
+}
+
+func (w *heartbeatWatcher) beat() {
+	select {
+	case w.beatC <- struct{}{}:
+	default:
+	}
+}
+
+func (w *heartbeatWatcher) close() error {
+	var errs []error
+	for _, f := range w.closers {
+		errs = append(errs, f())
+	}
+	return errors.Join(errs...)
+}
+
+// readBeats treats every read from r as a heartbeat until r is closed.
+func (w *heartbeatWatcher) readBeats(r io.Reader) {
+	buf := make([]byte, 512)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			w.beat()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// watch calls cancel with ErrHeartbeatTimeout if heartbeats are missed for the timeout.
+func (w *heartbeatWatcher) watch(ctx context.Context, logger klog.Logger, timeout time.Duration, cancel func(cause error)) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.beatC:
+			logger.V(2).Info("heartbeat")
+			timer.Reset(timeout)
+		case <-timer.C:
+			logger.V(0).Info("heartbeat timed out", "timeout", timeout)
+			cancel(ErrHeartbeatTimeout)
+			return
+		}
+	}
+}
+
+// setup makes cmd send heartbeats to the returned watcher.
+func (h *Heartbeat) setup(ctx context.Context, cmd *exec.Cmd) (*heartbeatWatcher, error) {
+	switch h.Mode {
+	case HeartbeatFile:
+		return h.setupFile(ctx, cmd)
+	case HeartbeatFD:
+		return h.setupFD(cmd)
+	case HeartbeatSocket:
+		return h.setupSocket(cmd)
+	default:
+		panic("unreachable")
+	}
+}
+
+func setEnv(cmd *exec.Cmd, key, value string) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, key+"="+value)
+}
+
+func (h *Heartbeat) tempPath(name string) (string, func() error, error) {
+	if h.Path != "" {
+		return h.Path, func() error { return nil }, nil
+	}
+	dir, err := os.MkdirTemp("", "klock-heartbeat")
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, name), func() error { return os.RemoveAll(dir) }, nil
+}
+
+func (h *Heartbeat) setupFile(ctx context.Context, cmd *exec.Cmd) (*heartbeatWatcher, error) {
+	path, remove, err := h.tempPath("heartbeat")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Join(err, remove())
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Join(err, remove())
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Join(err, remove())
+	}
+
+	w := newHeartbeatWatcher()
+	ctx, cancel := context.WithCancel(ctx)
+	w.closers = append(w.closers, func() error {
+		cancel()
+		return remove()
+	})
+	go func() {
+		ticker := time.NewTicker(max(h.Timeout/4, 10*time.Millisecond))
+		defer ticker.Stop()
+		last := stat.ModTime()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				x, err := os.Stat(path)
+				if err != nil || !x.ModTime().After(last) {
+					continue
+				}
+				last = x.ModTime()
+				w.beat()
+			}
+		}
+	}()
+	setEnv(cmd, EnvHeartbeatFile, path)
+	return w, nil
+}
+
+// heartbeatFD is the file descriptor number of the heartbeat pipe in the command,
+// the first of exec.Cmd.ExtraFiles.
+const heartbeatFD = 3
+
+func (h *Heartbeat) setupFD(cmd *exec.Cmd) (*heartbeatWatcher, error) {
+	r, wf, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	w := newHeartbeatWatcher()
+	// the write end is no longer needed by klock once the command inherits it
+	w.onStarted = func() { _ = wf.Close() }
+	w.closers = append(w.closers, func() error {
+		_ = wf.Close()
+		return r.Close()
+	})
+	go w.readBeats(r)
+	cmd.ExtraFiles = []*os.File{wf}
+	setEnv(cmd, EnvHeartbeatFD, strconv.Itoa(heartbeatFD))
+	return w, nil
+}
+
+func (h *Heartbeat) setupSocket(cmd *exec.Cmd) (*heartbeatWatcher, error) {
+	path, remove, err := h.tempPath("heartbeat.sock")
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Join(err, remove())
+	}
+
+	var (
+		w     = newHeartbeatWatcher()
+		mux   sync.Mutex
+		conns []net.Conn
+	)
+	w.closers = append(w.closers, func() error {
+		err := l.Close()
+		mux.Lock()
+		defer mux.Unlock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		return errors.Join(err, remove())
+	})
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mux.Lock()
+			conns = append(conns, c)
+			mux.Unlock()
+			w.beat()
+			go w.readBeats(c)
+		}
+	}()
+	setEnv(cmd, EnvHeartbeatSocket, path)
+	return w, nil
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Hook is an additional command run around the main command within the same lease hold.
+type Hook struct {
+	Args []string
+	// Timeout is the time limit of the hook; 0 means no limit.
+	Timeout time.Duration
+}
+
+// NewShellHook returns the Hook that runs script by sh.
+func NewShellHook(script string, timeout time.Duration) *Hook {
+	return &Hook{
+		Args:    []string{"sh", "-c", script},
+		Timeout: timeout,
+	}
+}
+
+// EnvExitCode is the environment variable that passes the exit status of the main command to post hooks.
+const EnvExitCode = "KLOCK_EXIT_CODE"
+
+var ErrHookFailed = errors.New("HookFailed")
+
+func (h *Hook) validate() error {
+	if h == nil {
+		return nil
+	}
+	if len(h.Args) == 0 || h.Args[0] == "" {
+		return fmt.Errorf("%w: hook program is empty", ErrInvalidProcess)
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("%w: hook timeout is negative", ErrInvalidProcess)
+	}
+	return nil
+}
+
+// runWithHooks runs the pre hook, the command and the post hooks.
+//
+// The post hooks run even if ctx is canceled, bounded only by their own timeouts,
+// so that teardown is not skipped when klock is interrupted.
+func (p *Process) runWithHooks(ctx context.Context, logger klog.Logger, args []string) error {
+	err := p.runHook(ctx, logger, "pre", p.PreHook, nil)
+	if err == nil {
+		err = p.runWithRetries(ctx, logger, args)
+	}
+
+	var (
+		postCtx = context.WithoutCancel(ctx)
+		env     = []string{EnvExitCode + "=" + strconv.Itoa(exitCode(err))}
+		errs    = []error{err}
+	)
+	if err != nil {
+		errs = append(errs, p.runHook(postCtx, logger, "on-failure", p.OnFailureHook, env))
+	}
+	errs = append(errs, p.runHook(postCtx, logger, "post", p.PostHook, env))
+	return errors.Join(errs...)
+}
+
+func (p *Process) runHook(ctx context.Context, logger klog.Logger, name string, h *Hook, env []string) error {
+	if h == nil {
+		return nil
+	}
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	logger = logger.WithValues("hook", name)
+	cmd, _, exited := p.newCmd(ctx, logger, h.Args)
+	cmd.Env = append(os.Environ(), env...)
+	logger.V(0).Info("hook start", "command", cmd.Args, "timeout", h.Timeout)
+	err := cmd.Run()
+	exited.Store(true)
+	logger.V(0).Info("hook end")
+	if err != nil {
+		// not wrapped by %w so that the exit status of the hook is not taken for that of the command
+		return fmt.Errorf("%w: %s hook: %v", ErrHookFailed, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package process
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// MaxLineLength is the maximum length of the line passed to the sink of LineWriter.
+// The longer line is split, e.g. binary output or progress bars without newlines.
+const MaxLineLength = 64 * 1024
+
+// LineWriter calls the sink for each line written to it.
+// The lines longer than MaxLineLength are split.
+// The trailing incomplete line is passed to the sink by Close.
+type LineWriter struct {
+	mux  sync.Mutex
+	buf  bytes.Buffer
+	sink func(line []byte) error
+}
+
+// NewLineWriter returns the LineWriter.
+// The line passed to the sink does not contain the newline.
+func NewLineWriter(sink func(line []byte) error) *LineWriter {
+	return &LineWriter{
+		sink: sink,
+	}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	_, _ = w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		switch {
+		case i >= 0 && i <= MaxLineLength:
+			line := w.buf.Next(i + 1)
+			if err := w.sink(line[:i]); err != nil {
+				return len(p), err
+			}
+		case w.buf.Len() > MaxLineLength:
+			if err := w.sink(w.buf.Next(MaxLineLength)); err != nil {
+				return len(p), err
+			}
+		default:
+			return len(p), nil
+		}
+	}
+}
+
+func (w *LineWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	line := w.buf.Bytes()
+	w.buf.Reset()
+	return w.sink(line)
+}
+
+// NewPrefixWriter returns the writer that writes each line to w with the prefix.
+func NewPrefixWriter(w io.Writer, prefix func() string) *LineWriter {
+	return NewLineWriter(func(line []byte) error {
+		_, err := fmt.Fprintf(w, "%s%s\n", prefix(), line)
+		return err
+	})
+}
+
+// NewLogWriter returns the writer that emits each line as a log record.
+func NewLogWriter(logger klog.Logger, stream string) *LineWriter {
+	return NewLineWriter(func(line []byte) error {
+		logger.V(0).Info("output", "stream", stream, "line", string(line))
+		return nil
+	})
+}
+
+// PrefixData is the data for the template of the output prefix.
+type PrefixData struct {
+	// Namespace is the namespace of the lease.
+	Namespace string
+	// Name is the name of the lease.
+	Name string
+	// Identity is the id of the lease holder.
+	Identity string
+	// Stream is stdout or stderr.
+	Stream string
+	// Timestamp is the time when the line is written, in RFC3339.
+	Timestamp string
+}
+
+// NewTemplatePrefix returns the prefix function for NewPrefixWriter
+// that executes the template text with data, setting Timestamp for each line.
+func NewTemplatePrefix(text string, data PrefixData) (func() string, error) {
+	tmpl, err := template.New("prefix").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func() string {
+		var b strings.Builder
+		d := data
+		d.Timestamp = time.Now().Format(time.RFC3339)
+		if err := tmpl.Execute(&b, d); err != nil {
+			return fmt.Sprintf("[%s] ", err)
+		}
+		return b.String()
+	}, nil
+}
+
+// RotatingFile is the file that is rotated when it grows beyond MaxSize.
+//
+// The rotated files are named PATH.1, PATH.2, ... up to PATH.MaxBackups, PATH.1 being the newest.
+type RotatingFile struct {
+	mux        sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+// NewRotatingFile opens the file at path for appending.
+// maxSize 0 means no rotation.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	if maxSize < 0 {
+		return nil, fmt.Errorf("max size is negative: %d", maxSize)
+	}
+	if maxBackups < 0 {
+		return nil, fmt.Errorf("max backups is negative: %d", maxBackups)
+	}
+	r := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return errors.Join(err, f.Close())
+	}
+	r.f = f
+	r.size = stat.Size()
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if r.maxBackups == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+	for i := r.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(r.backupPath(i), r.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.backupPath(1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *RotatingFile) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) Close() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.f.Close()
+}
+
+// TailBuffer keeps the last lines written to its writers.
+type TailBuffer struct {
+	mux   sync.Mutex
+	size  int
+	lines []string
+	next  int
+	full  bool
+}
+
+// NewTailBuffer returns the TailBuffer that keeps the last size lines.
+func NewTailBuffer(size int) *TailBuffer {
+	return &TailBuffer{
+		size:  size,
+		lines: make([]string, size),
+	}
+}
+
+func (b *TailBuffer) add(line string) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.size == 0 {
+		return
+	}
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % b.size
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Lines returns the kept lines, oldest first.
+func (b *TailBuffer) Lines() []string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if !b.full {
+		return append([]string{}, b.lines[:b.next]...)
+	}
+	return append(append([]string{}, b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+// Writer returns a new writer to the buffer.
+// Use a writer per stream so that lines of the streams are not mixed.
+func (b *TailBuffer) Writer() *LineWriter {
+	return NewLineWriter(func(line []byte) error {
+		b.add(string(line))
+		return nil
+	})
+}
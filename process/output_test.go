@@ -0,0 +1,175 @@
+package process_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineWriter(t *testing.T) {
+	for _, tc := range []struct {
+		title  string
+		writes []string
+		want   []string
+	}{
+		{
+			title:  "no lines",
+			writes: []string{""},
+			want:   nil,
+		},
+		{
+			title:  "a line",
+			writes: []string{"line\n"},
+			want:   []string{"line"},
+		},
+		{
+			title:  "lines in a write",
+			writes: []string{"line1\nline2\n"},
+			want:   []string{"line1", "line2"},
+		},
+		{
+			title:  "a line across writes",
+			writes: []string{"li", "ne1\nli", "ne2\n"},
+			want:   []string{"line1", "line2"},
+		},
+		{
+			title:  "incomplete line",
+			writes: []string{"line1\nline2"},
+			want:   []string{"line1", "line2"},
+		},
+		{
+			title:  "a line of the max length across writes",
+			writes: []string{strings.Repeat("a", process.MaxLineLength), "\n"},
+			want:   []string{strings.Repeat("a", process.MaxLineLength)},
+		},
+		{
+			title:  "a too long line",
+			writes: []string{strings.Repeat("a", process.MaxLineLength+1) + "\n"},
+			want:   []string{strings.Repeat("a", process.MaxLineLength), "a"},
+		},
+		{
+			title:  "a too long line without newlines",
+			writes: []string{strings.Repeat("a\r", process.MaxLineLength)},
+			want:   []string{strings.Repeat("a\r", process.MaxLineLength/2), strings.Repeat("a\r", process.MaxLineLength/2)},
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			var got []string
+			w := process.NewLineWriter(func(line []byte) error {
+				got = append(got, string(line))
+				return nil
+			})
+			for _, x := range tc.writes {
+				n, err := w.Write([]byte(x))
+				assert.Nil(t, err)
+				assert.Equal(t, len(x), n)
+			}
+			assert.Nil(t, w.Close())
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	prefix, err := process.NewTemplatePrefix("[{{.Name}} {{.Identity}} {{.Stream}}] ", process.PrefixData{
+		Namespace: "default",
+		Name:      "lease",
+		Identity:  "id",
+		Stream:    "stdout",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	var b bytes.Buffer
+	w := process.NewPrefixWriter(&b, prefix)
+	_, err = w.Write([]byte("line1\nline2\nline3"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, `[lease id stdout] line1
+[lease id stdout] line2
+[lease id stdout] line3
+`, b.String())
+
+	t.Run("invalid template", func(t *testing.T) {
+		_, err := process.NewTemplatePrefix("{{.Unknown", process.PrefixData{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		path = filepath.Join(dir, "out")
+	)
+	f, err := process.NewRotatingFile(path, 10, 2)
+	if !assert.Nil(t, err) {
+		return
+	}
+	for _, x := range []string{"line1\n", "line2\n", "line3\n", "line4\n"} {
+		_, err := f.Write([]byte(x))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, f.Close())
+
+	for name, want := range map[string]string{
+		"out":   "line4\n",
+		"out.1": "line3\n",
+		"out.2": "line2\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if !assert.Nil(t, err, name) {
+			continue
+		}
+		assert.Equal(t, want, string(got), name)
+	}
+	_, err = os.Stat(filepath.Join(dir, "out.3"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTailBuffer(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		size  int
+		input string
+		want  []string
+	}{
+		{
+			title: "empty",
+			size:  3,
+			input: "",
+			want:  []string{},
+		},
+		{
+			title: "less than size",
+			size:  3,
+			input: "line1\nline2\n",
+			want:  []string{"line1", "line2"},
+		},
+		{
+			title: "more than size",
+			size:  3,
+			input: "line1\nline2\nline3\nline4\nline5",
+			want:  []string{"line3", "line4", "line5"},
+		},
+		{
+			title: "zero size",
+			size:  0,
+			input: "line1\n",
+			want:  []string{},
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			b := process.NewTailBuffer(tc.size)
+			w := b.Writer()
+			_, err := w.Write([]byte(tc.input))
+			assert.Nil(t, err)
+			assert.Nil(t, w.Close())
+			assert.Equal(t, tc.want, b.Lines())
+		})
+	}
+}
@@ -7,14 +7,24 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"slices"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"al.essio.dev/pkg/shellescape"
 	"github.com/berquerant/k8s-lease/lease"
+	"k8s.io/klog/v2"
 )
 
-func NewProcess(locker *lease.Locker, name string, arg ...string) *Process {
+// Locker runs a function under lock control, e.g. *lease.Locker and *lease.Once.
+type Locker interface {
+	LockAndRun(ctx context.Context, f func(context.Context) error) error
+	Logger(ctx context.Context) klog.Logger
+	String() string
+}
+
+func NewProcess(locker Locker, name string, arg ...string) *Process {
 	return &Process{
 		locker: locker,
 		Args:   append([]string{name}, arg...),
@@ -23,13 +33,45 @@ func NewProcess(locker *lease.Locker, name string, arg ...string) *Process {
 
 // Process is an external command executed under lock control.
 type Process struct {
-	locker       *lease.Locker
+	locker       Locker
 	Stdin        io.Reader
 	Stdout       io.Writer
 	Stderr       io.Writer
 	Args         []string
 	CancelSignal os.Signal
 	WaitDelay    time.Duration
+	// Retries is the maximum number of times the command is re-run after a failure while holding the lock.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled on each subsequent retry up to MaxBackoff.
+	RetryBackoff time.Duration
+	// RetryOnExitCodes restricts retries to these exit codes.
+	// Empty means retrying on any non-zero exit code.
+	RetryOnExitCodes []int
+	// PreHook runs before the command while holding the lock.
+	// If it fails, the command is not run.
+	PreHook *Hook
+	// PostHook runs after the command while holding the lock, even if the command fails.
+	PostHook *Hook
+	// OnFailureHook runs after the command while holding the lock, only if the command fails.
+	OnFailureHook *Hook
+	// Heartbeat enables the watchdog of the command if not nil.
+	Heartbeat *Heartbeat
+	// WarnSignal is sent to the command once lease.RenewWarning is notified during the attempt, if not nil.
+	WarnSignal os.Signal
+	// Restart restarts the command after it exits while holding the lock.
+	// If the leadership is lost, the command is stopped and the lock is waited for again.
+	Restart RestartPolicy
+	// RestartBackoff is the delay before the first restart, doubled on each subsequent restart up to MaxBackoff.
+	RestartBackoff time.Duration
+	// CrashLoopThreshold is the number of the exits within CrashLoopWindow
+	// beyond which the lock is given up with ErrCrashLoop. 0 means no limit.
+	CrashLoopThreshold int
+	// CrashLoopWindow is the window of CrashLoopThreshold.
+	CrashLoopWindow time.Duration
+
+	report Report
+	// endHold cancels the context of LockAndRun to release the lock.
+	endHold context.CancelCauseFunc
 }
 
 var ErrInvalidProcess = errors.New("InvalidProcess")
@@ -44,6 +86,23 @@ func (p *Process) validate() error {
 	if p.Args[0] == "" {
 		return fmt.Errorf("%w: program is empty", ErrInvalidProcess)
 	}
+	if p.Retries < 0 {
+		return fmt.Errorf("%w: retries is negative", ErrInvalidProcess)
+	}
+	for _, h := range []*Hook{p.PreHook, p.PostHook, p.OnFailureHook} {
+		if err := h.validate(); err != nil {
+			return err
+		}
+	}
+	if err := p.Heartbeat.validate(); err != nil {
+		return err
+	}
+	if err := p.Restart.validate(); err != nil {
+		return err
+	}
+	if p.CrashLoopThreshold < 0 {
+		return fmt.Errorf("%w: crash loop threshold is negative", ErrInvalidProcess)
+	}
 	return nil
 }
 
@@ -56,6 +115,9 @@ func (p *Process) quotedArgs() []string {
 }
 
 // Run starts the specified command and waits for it to complete with the lease lock.
+//
+// With Restart, Run keeps the command running while holding the lock,
+// and waits for the lock again if the leadership is lost.
 func (p *Process) Run(ctx context.Context) error {
 	if err := p.validate(); err != nil {
 		return err
@@ -65,29 +127,204 @@ func (p *Process) Run(ctx context.Context) error {
 		logger = p.locker.Logger(ctx)
 		args   = p.quotedArgs()
 		run    = func(ctx context.Context) error {
-			cmd := exec.CommandContext(ctx, args[0], args[1:]...)
-			cmd.Stdin = p.Stdin
-			cmd.Stdout = p.Stdout
-			cmd.Stderr = p.Stderr
-			cmd.WaitDelay = p.WaitDelay
-			if s := p.CancelSignal; s != syscall.Signal(0) {
-				cmd.Cancel = func() error {
-					sigstr := SignalIntoString(s)
-					signum, _ := SignalIntoInt(s)
-					logger.V(0).Info("process cancel", "signal", sigstr, "signum", signum, "waitDelay", cmd.WaitDelay)
-					return cmd.Process.Signal(s)
-				}
+			if p.Restart != RestartNever {
+				return p.supervise(ctx, logger, args)
 			}
-			logger.V(0).Info("process start", "command", cmd.Args)
-			err := cmd.Run()
-			logger.V(0).Info("process end")
-			return err
+			return p.runWithHooks(ctx, logger, args)
 		}
 	)
+	p.report = Report{
+		Args:     p.Args,
+		ExitCode: -1,
+	}
 
-	if err := p.locker.LockAndRun(ctx, run); err != nil {
+	for {
+		holdCtx, endHold := context.WithCancelCause(ctx)
+		p.endHold = endHold
+		err := p.locker.LockAndRun(holdCtx, run)
+		endHold(nil)
+		if err == nil {
+			return nil
+		}
+		if p.Restart != RestartNever && errors.Is(err, lease.ErrLeaderLost) && ctx.Err() == nil {
+			logger.V(0).Info("process lost the lock, waiting again", "err", err)
+			continue
+		}
 		logger.Error(err, "process LockAndRun")
 		return fmt.Errorf("%w: locker=%s", err, p.locker)
 	}
-	return nil
+}
+
+// runWithRetries runs the command until it succeeds or the retries are exhausted.
+// The lock is held throughout, so no other holder can run in between attempts.
+func (p *Process) runWithRetries(ctx context.Context, logger klog.Logger, args []string) error {
+	backoff := p.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		p.report.Attempts = attempt
+		err := p.runCommand(ctx, logger.WithValues("attempt", attempt), args)
+		if err == nil {
+			return nil
+		}
+		if p.Retries == 0 {
+			return err
+		}
+		err = fmt.Errorf("%w: attempts=%d", err, attempt)
+		if attempt > p.Retries || ctx.Err() != nil || !p.isRetryable(err) {
+			return err
+		}
+		logger.V(0).Info("process retry", "attempt", attempt, "retries", p.Retries, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = nextBackoff(backoff, p.RetryBackoff)
+	}
+}
+
+func (p *Process) isRetryable(err error) bool {
+	if errors.Is(err, ErrHeartbeatTimeout) {
+		// the command is wedged, give up the lock
+		return false
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	return len(p.RetryOnExitCodes) == 0 || slices.Contains(p.RetryOnExitCodes, exitCode(err))
+}
+
+func (p *Process) runCommand(ctx context.Context, logger klog.Logger, args []string) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	cmd, sent, exited := p.newCmd(ctx, logger, args)
+	cmd.Stdin = p.Stdin
+
+	var watcher *heartbeatWatcher
+	if p.Heartbeat != nil {
+		w, err := p.Heartbeat.setup(ctx, cmd)
+		if err != nil {
+			return lease.Fatal(fmt.Errorf("%w: failed to setup heartbeat", err))
+		}
+		defer func() {
+			if err := w.close(); err != nil {
+				logger.Error(err, "close heartbeat")
+			}
+		}()
+		watcher = w
+	}
+
+	logger.V(0).Info("process start", "command", cmd.Args)
+	if p.report.StartTime.IsZero() {
+		p.report.StartTime = time.Now()
+	}
+	if err := cmd.Start(); err != nil {
+		// not to campaign or restart for the command that never starts
+		return lease.Fatal(fmt.Errorf("%w: failed to start", err))
+	}
+	if watcher != nil {
+		watcher.onStarted()
+		go watcher.watch(ctx, logger, p.Heartbeat.Timeout, func(cause error) {
+			cancel(cause)
+			// stop renewing the lease for the wedged command
+			p.endHold(cause)
+		})
+	}
+	if warnC := lease.RenewWarning(ctx); warnC != nil && p.WarnSignal != nil {
+		go p.warn(ctx, logger, cmd, warnC, sent)
+	}
+	waitErr := cmd.Wait()
+	exited.Store(true)
+	err := newSignalError(waitErr, sent)
+	p.report.EndTime = time.Now()
+	p.report.ExitCode = exitCode(err)
+	p.report.Signal = nil
+	p.report.SignalSent = false
+	var sigErr *SignalError
+	if errors.As(err, &sigErr) {
+		p.report.Signal = sigErr.Signal
+		p.report.SignalSent = sigErr.Sent
+	}
+	logger.V(0).Info("process end", "exitCode", p.report.ExitCode)
+	if errors.Is(context.Cause(ctx), ErrHeartbeatTimeout) {
+		return errors.Join(ErrHeartbeatTimeout, err)
+	}
+	return err
+}
+
+// warn sends WarnSignal to the command when warnC is closed.
+func (p *Process) warn(ctx context.Context, logger klog.Logger, cmd *exec.Cmd, warnC <-chan struct{}, sent *sentSignals) {
+	select {
+	case <-ctx.Done():
+	case <-warnC:
+		sigstr := SignalIntoString(p.WarnSignal)
+		signum, _ := SignalIntoInt(p.WarnSignal)
+		logger.V(0).Info("process warn", "signal", sigstr, "signum", signum)
+		sent.add(p.WarnSignal)
+		if err := cmd.Process.Signal(p.WarnSignal); err != nil {
+			logger.Error(err, "process warn")
+		}
+	}
+}
+
+// newCmd returns the command that is stopped by CancelSignal and WaitDelay when ctx is done,
+// the signals sent to it by klock, and the flag to be set when the command exited.
+//
+// On heartbeat timeout, the command is killed after HeartbeatKillAfter even if WaitDelay is 0.
+func (p *Process) newCmd(ctx context.Context, logger klog.Logger, args []string) (*exec.Cmd, *sentSignals, *atomic.Bool) {
+	var (
+		cmd    = exec.CommandContext(ctx, args[0], args[1:]...)
+		sent   = &sentSignals{}
+		exited = &atomic.Bool{}
+	)
+	cmd.Stdout = p.Stdout
+	cmd.Stderr = p.Stderr
+	cmd.WaitDelay = p.WaitDelay
+	if s := p.CancelSignal; s != nil && s != syscall.Signal(0) {
+		cmd.Cancel = func() error {
+			killAfter := cmd.WaitDelay
+			if killAfter == 0 && errors.Is(context.Cause(ctx), ErrHeartbeatTimeout) {
+				killAfter = HeartbeatKillAfter
+			}
+			sigstr := SignalIntoString(s)
+			signum, _ := SignalIntoInt(s)
+			logger.V(0).Info("process cancel", "signal", sigstr, "signum", signum, "killAfter", killAfter)
+			sent.add(s)
+			if killAfter > 0 {
+				time.AfterFunc(killAfter, func() {
+					if exited.Load() {
+						return
+					}
+					logger.V(0).Info("process kill", "killAfter", killAfter)
+					sent.add(syscall.SIGKILL)
+					_ = cmd.Process.Kill()
+				})
+			}
+			return cmd.Process.Signal(s)
+		}
+	} else {
+		cmd.Cancel = func() error {
+			sent.add(syscall.SIGKILL)
+			return cmd.Process.Kill()
+		}
+	}
+	return cmd, sent, exited
+}
+
+// exitCode returns the exit status of the command that returned err.
+// 128+N if the command was terminated by the signal N, like shells.
+// -1 if the command did not exit normally.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var sigErr *SignalError
+	if errors.As(err, &sigErr) {
+		return sigErr.ExitCode()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
 }
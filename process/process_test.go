@@ -0,0 +1,60 @@
+package process_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestWarnSignal(t *testing.T) {
+	t.Run("should warn only the attempt while the renewal fails", func(t *testing.T) {
+		var (
+			dir     = t.TempDir()
+			counter = filepath.Join(dir, "counter")
+			warned  = filepath.Join(dir, "warned")
+			script  = filepath.Join(dir, "script.sh")
+			client  = fake.NewClientset()
+		)
+		if !assert.Nil(t, os.WriteFile(script, []byte(`#!/bin/sh
+trap 'echo x >> `+warned+`; exit 1' USR1
+echo x >> `+counter+`
+sleep 2 &
+wait $!`), 0750)) {
+			return
+		}
+		// fail the renewals until the command is warned
+		client.PrependReactor("update", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+			if _, err := os.Stat(warned); err != nil {
+				return true, nil, errors.New("unavailable")
+			}
+			return false, nil, nil
+		})
+		locker, err := lease.NewLocker("default", "warn", "warn-id", client.CoordinationV1(),
+			lease.WithLeaseDuration(3*time.Second),
+			lease.WithRenewDeadline(2*time.Second),
+			lease.WithRetryPeriod(100*time.Millisecond),
+			lease.WithRenewWarningFraction(0.2),
+		)
+		if !assert.Nil(t, err) {
+			return
+		}
+		p := process.NewProcess(locker, "sh", script)
+		p.WarnSignal = syscall.SIGUSR1
+		p.Retries = 1
+		p.RetryBackoff = 500 * time.Millisecond
+		assert.Nil(t, p.Run(context.TODO()))
+		assert.Equal(t, 2, countLines(t, counter))
+		assert.Equal(t, 1, countLines(t, warned))
+	})
+}
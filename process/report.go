@@ -0,0 +1,64 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Report is the summary of the last Run.
+type Report struct {
+	Args []string
+	// Attempts is the number of times the command was run.
+	Attempts int
+	// ExitCode is the exit status of the last attempt; 128+N if terminated by the signal N.
+	// -1 if the command did not exit.
+	ExitCode int
+	// Signal is the signal that terminated the last attempt, if any.
+	Signal os.Signal
+	// SignalSent is true if Signal was sent by klock.
+	SignalSent bool
+	StartTime  time.Time
+	EndTime    time.Time
+}
+
+// Report returns the summary of the last Run.
+func (p *Process) Report() Report { return p.report }
+
+func (r Report) Elapsed() time.Duration {
+	if r.StartTime.IsZero() || r.EndTime.IsZero() {
+		return 0
+	}
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// Write writes the human-readable summary to w.
+func (r Report) Write(w io.Writer) error {
+	lines := []string{
+		fmt.Sprintf("command: %s", strings.Join(r.Args, " ")),
+		fmt.Sprintf("attempts: %d", r.Attempts),
+		fmt.Sprintf("exit status: %d", r.ExitCode),
+	}
+	if r.Signal != nil {
+		by := "not sent by klock"
+		if r.SignalSent {
+			by = "sent by klock"
+		}
+		lines = append(lines, fmt.Sprintf("signal: %s (%s)", SignalIntoString(r.Signal), by))
+	}
+	if !r.StartTime.IsZero() {
+		lines = append(lines,
+			fmt.Sprintf("start: %s", r.StartTime.Format(time.RFC3339)),
+			fmt.Sprintf("end: %s", r.EndTime.Format(time.RFC3339)),
+			fmt.Sprintf("elapsed: %s", r.Elapsed()),
+		)
+	}
+	for _, x := range lines {
+		if _, err := fmt.Fprintln(w, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
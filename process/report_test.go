@@ -0,0 +1,75 @@
+package process_test
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		title  string
+		report process.Report
+		want   string
+	}{
+		{
+			title: "not started",
+			report: process.Report{
+				Args:     []string{"echo", "ok"},
+				ExitCode: -1,
+			},
+			want: `command: echo ok
+attempts: 0
+exit status: -1
+`,
+		},
+		{
+			title: "exited",
+			report: process.Report{
+				Args:      []string{"false"},
+				Attempts:  2,
+				ExitCode:  1,
+				StartTime: start,
+				EndTime:   start.Add(1500 * time.Millisecond),
+			},
+			want: `command: false
+attempts: 2
+exit status: 1
+start: 2026-01-02T03:04:05Z
+end: 2026-01-02T03:04:06Z
+elapsed: 1.5s
+`,
+		},
+		{
+			title: "signaled",
+			report: process.Report{
+				Args:       []string{"sleep", "10"},
+				Attempts:   1,
+				ExitCode:   143,
+				Signal:     syscall.SIGTERM,
+				SignalSent: true,
+				StartTime:  start,
+				EndTime:    start.Add(time.Second),
+			},
+			want: `command: sleep 10
+attempts: 1
+exit status: 143
+signal: SIGTERM (sent by klock)
+start: 2026-01-02T03:04:05Z
+end: 2026-01-02T03:04:06Z
+elapsed: 1s
+`,
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			var b bytes.Buffer
+			assert.Nil(t, tc.report.Write(&b))
+			assert.Equal(t, tc.want, b.String())
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"k8s.io/klog/v2"
+)
+
+// RestartPolicy decides whether the command is restarted after it exits while holding the lock.
+type RestartPolicy string
+
+const (
+	// RestartNever runs the command once; the default.
+	RestartNever RestartPolicy = ""
+	// RestartOnFailure restarts the command if it fails.
+	RestartOnFailure RestartPolicy = "on-failure"
+	// RestartAlways restarts the command whenever it exits.
+	RestartAlways RestartPolicy = "always"
+)
+
+func (r RestartPolicy) validate() error {
+	switch r {
+	case RestartNever, RestartOnFailure, RestartAlways:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown restart policy: %s", ErrInvalidProcess, r)
+	}
+}
+
+func (r RestartPolicy) restart(err error) bool {
+	switch r {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// ErrCrashLoop is returned when the command exits too often under Restart.
+var ErrCrashLoop = errors.New("CrashLoop")
+
+const (
+	// DefaultCrashLoopThreshold is the default of Process.CrashLoopThreshold.
+	DefaultCrashLoopThreshold = 5
+	// DefaultCrashLoopWindow is the default of Process.CrashLoopWindow.
+	DefaultCrashLoopWindow = time.Minute
+	// MaxBackoff is the upper bound of the doubled backoffs of the restarts and the retries.
+	MaxBackoff = 5 * time.Minute
+)
+
+// nextBackoff doubles the backoff up to MaxBackoff, or the initial one if it is greater.
+func nextBackoff(backoff, initial time.Duration) time.Duration {
+	return min(backoff*2, max(MaxBackoff, initial))
+}
+
+// crashLoopDetector counts the exits of the command within the window.
+type crashLoopDetector struct {
+	threshold int
+	window    time.Duration
+	exits     []time.Time
+}
+
+// exited records the exit and returns true if the exits within the window exceed the threshold.
+func (d *crashLoopDetector) exited(now time.Time) bool {
+	if d.threshold <= 0 {
+		return false
+	}
+	d.exits = append(d.exits, now)
+	for len(d.exits) > 0 && now.Sub(d.exits[0]) > d.window {
+		d.exits = d.exits[1:]
+	}
+	return len(d.exits) > d.threshold
+}
+
+// supervise restarts the command according to Restart while holding the lock.
+//
+// The backoff is doubled on each restart, and reset if the command has run longer than CrashLoopWindow.
+func (p *Process) supervise(ctx context.Context, logger klog.Logger, args []string) error {
+	var (
+		backoff   = p.RestartBackoff
+		crashLoop = &crashLoopDetector{
+			threshold: p.CrashLoopThreshold,
+			window:    p.CrashLoopWindow,
+		}
+	)
+	for restarts := 0; ; restarts++ {
+		startTime := time.Now()
+		err := p.runWithHooks(ctx, logger.WithValues("restarts", restarts), args)
+		if ctx.Err() != nil || !p.Restart.restart(err) || errors.Is(err, ErrHeartbeatTimeout) || errors.Is(err, lease.ErrFatal) {
+			// the wedged command or the command that cannot start is not restarted, give up the lock
+			return err
+		}
+		now := time.Now()
+		if crashLoop.exited(now) {
+			logger.V(0).Info("process crash loop", "restarts", restarts, "threshold", p.CrashLoopThreshold, "window", p.CrashLoopWindow)
+			return errors.Join(fmt.Errorf("%w: restarts=%d", ErrCrashLoop, restarts), err)
+		}
+		if now.Sub(startTime) >= p.CrashLoopWindow {
+			backoff = p.RestartBackoff
+		}
+		logger.V(0).Info("process restart", "restarts", restarts, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = nextBackoff(backoff, p.RestartBackoff)
+	}
+}
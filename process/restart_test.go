@@ -0,0 +1,154 @@
+package process_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/berquerant/k8s-lease/lease"
+	"github.com/berquerant/k8s-lease/process"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2"
+)
+
+// fakeLocker runs the function without a lease, losing the leadership the given times first.
+type fakeLocker struct {
+	loseTimes int
+	calls     int
+	// released reports whether the context was done when the function returned.
+	released bool
+}
+
+func (l *fakeLocker) LockAndRun(ctx context.Context, f func(context.Context) error) error {
+	l.calls++
+	if l.calls <= l.loseTimes {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		return errors.Join(lease.ErrLeaderLost, f(ctx))
+	}
+	err := f(ctx)
+	l.released = ctx.Err() != nil
+	return err
+}
+
+func (*fakeLocker) Logger(context.Context) klog.Logger { return klog.Background() }
+func (*fakeLocker) String() string                     { return "fake" }
+
+// countScript returns the script that appends a line to the file and exits with the status
+// given by the number of the lines.
+func countScript(t *testing.T, exit string) (script, counter string) {
+	t.Helper()
+	dir := t.TempDir()
+	counter = filepath.Join(dir, "counter")
+	script = filepath.Join(dir, "script.sh")
+	data := `#!/bin/sh
+echo x >> ` + counter + `
+n=$(wc -l < ` + counter + `)
+` + exit
+	if err := os.WriteFile(script, []byte(data), 0750); err != nil {
+		t.Fatal(err)
+	}
+	return script, counter
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(b) / len("x\n")
+}
+
+func TestRestart(t *testing.T) {
+	t.Run("on-failure should restart until success", func(t *testing.T) {
+		script, counter := countScript(t, `[ "$n" -ge 3 ]`)
+		p := process.NewProcess(&fakeLocker{}, "sh", script)
+		p.Restart = process.RestartOnFailure
+		p.RestartBackoff = time.Millisecond
+		assert.Nil(t, p.Run(context.TODO()))
+		assert.Equal(t, 3, countLines(t, counter))
+	})
+
+	t.Run("should give up on crash loop", func(t *testing.T) {
+		script, counter := countScript(t, "exit 1")
+		p := process.NewProcess(&fakeLocker{}, "sh", script)
+		p.Restart = process.RestartAlways
+		p.RestartBackoff = time.Millisecond
+		p.CrashLoopThreshold = 2
+		p.CrashLoopWindow = time.Minute
+		err := p.Run(context.TODO())
+		assert.ErrorIs(t, err, process.ErrCrashLoop)
+		assert.Equal(t, 3, countLines(t, counter))
+	})
+
+	t.Run("should wait again on leader lost", func(t *testing.T) {
+		locker := &fakeLocker{loseTimes: 2}
+		p := process.NewProcess(locker, "true")
+		p.Restart = process.RestartOnFailure
+		assert.Nil(t, p.Run(context.TODO()))
+		assert.Equal(t, 3, locker.calls)
+	})
+
+	t.Run("should not wait again without restart", func(t *testing.T) {
+		locker := &fakeLocker{loseTimes: 1}
+		p := process.NewProcess(locker, "true")
+		assert.ErrorIs(t, p.Run(context.TODO()), lease.ErrLeaderLost)
+		assert.Equal(t, 1, locker.calls)
+	})
+
+	t.Run("should not restart on heartbeat timeout", func(t *testing.T) {
+		script, counter := countScript(t, "exec sleep 10")
+		locker := &fakeLocker{}
+		p := process.NewProcess(locker, "sh", script)
+		p.Restart = process.RestartAlways
+		p.RestartBackoff = time.Millisecond
+		p.CancelSignal = syscall.SIGTERM
+		p.Heartbeat = &process.Heartbeat{
+			Mode:    process.HeartbeatFile,
+			Timeout: 100 * time.Millisecond,
+		}
+		assert.ErrorIs(t, p.Run(context.TODO()), process.ErrHeartbeatTimeout)
+		assert.Equal(t, 1, countLines(t, counter))
+		assert.True(t, locker.released)
+	})
+
+	t.Run("should not campaign again on heartbeat timeout", func(t *testing.T) {
+		script, counter := countScript(t, "exec sleep 10")
+		locker, err := lease.NewLocker("default", "campaign", "campaign-id", fake.NewClientset().CoordinationV1())
+		if !assert.Nil(t, err) {
+			return
+		}
+		p := process.NewProcess(lease.NewForever(locker, time.Millisecond), "sh", script)
+		p.CancelSignal = syscall.SIGTERM
+		p.Heartbeat = &process.Heartbeat{
+			Mode:    process.HeartbeatFile,
+			Timeout: 100 * time.Millisecond,
+		}
+		assert.ErrorIs(t, p.Run(context.TODO()), process.ErrHeartbeatTimeout)
+		assert.Equal(t, 1, countLines(t, counter))
+	})
+
+	t.Run("should not restart the command that cannot start", func(t *testing.T) {
+		locker := &fakeLocker{}
+		p := process.NewProcess(locker, "klock-no-such-command")
+		p.Restart = process.RestartAlways
+		p.RestartBackoff = time.Millisecond
+		err := p.Run(context.TODO())
+		assert.ErrorIs(t, err, lease.ErrFatal)
+		assert.ErrorIs(t, err, exec.ErrNotFound)
+		assert.Equal(t, 1, locker.calls)
+	})
+
+	t.Run("should reject unknown policy", func(t *testing.T) {
+		p := process.NewProcess(&fakeLocker{}, "true")
+		p.Restart = "sometimes"
+		assert.ErrorIs(t, p.Run(context.TODO()), process.ErrInvalidProcess)
+	})
+}
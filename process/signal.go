@@ -1,8 +1,12 @@
 package process
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"strconv"
+	"sync"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -54,3 +58,61 @@ func SignalIntoString(s os.Signal) string {
 	}
 	return s.String()
 }
+
+// SignalError is the error of the command terminated by a signal.
+type SignalError struct {
+	Signal syscall.Signal
+	// Sent is true if the signal was sent by klock.
+	Sent bool
+	Err  *exec.ExitError
+}
+
+func (e *SignalError) Error() string {
+	return fmt.Sprintf("%s: signal=%s sent=%t", e.Err, SignalIntoString(e.Signal), e.Sent)
+}
+
+func (e *SignalError) Unwrap() error { return e.Err }
+
+// ExitCode returns 128+N for the signal N, like shells.
+func (e *SignalError) ExitCode() int { return 128 + int(e.Signal) }
+
+// newSignalError returns SignalError if err shows that the command was terminated by a signal.
+// Otherwise returns err as it is.
+func newSignalError(err error, sent *sentSignals) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return err
+	}
+	return &SignalError{
+		Signal: status.Signal(),
+		Sent:   sent.has(status.Signal()),
+		Err:    exitErr,
+	}
+}
+
+// sentSignals is the set of the signals sent to the command.
+type sentSignals struct {
+	mux     sync.Mutex
+	signals []os.Signal
+}
+
+func (s *sentSignals) add(sig os.Signal) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.signals = append(s.signals, sig)
+}
+
+func (s *sentSignals) has(sig os.Signal) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, x := range s.signals {
+		if x == sig {
+			return true
+		}
+	}
+	return false
+}
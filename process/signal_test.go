@@ -1,8 +1,12 @@
 package process_test
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/berquerant/k8s-lease/process"
 	"github.com/stretchr/testify/assert"
@@ -59,3 +63,23 @@ func TestNewSignal(t *testing.T) {
 		})
 	}
 }
+
+func TestSentSignal(t *testing.T) {
+	t.Run("should not take the kill by others for WaitDelay", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+		defer cancel()
+		script := filepath.Join(t.TempDir(), "script.sh")
+		if err := os.WriteFile(script, []byte(`trap 'kill -KILL $$' TERM; sleep 10 & wait`), 0750); err != nil {
+			t.Fatal(err)
+		}
+		p := process.NewProcess(&fakeLocker{}, "sh", script)
+		p.CancelSignal = syscall.SIGTERM
+		p.WaitDelay = 10 * time.Second
+		var sigErr *process.SignalError
+		if !assert.ErrorAs(t, p.Run(ctx), &sigErr) {
+			return
+		}
+		assert.Equal(t, syscall.SIGKILL, sigErr.Signal)
+		assert.False(t, sigErr.Sent)
+	})
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -197,4 +199,584 @@ crispy
 			assert.Equal(t, want, got)
 		})
 	})
+
+	t.Run("retry", func(t *testing.T) {
+		for _, tc := range []struct {
+			title      string
+			name       string
+			failures   int
+			args       []string
+			exitStatus int
+			attempts   int
+		}{
+			{
+				title:      "should succeed after retries",
+				name:       "retry-should-succeed",
+				failures:   2,
+				args:       []string{"--retries", "2", "--retry-backoff", "100ms"},
+				exitStatus: 0,
+				attempts:   3,
+			},
+			{
+				title:      "should fail when retries are exhausted",
+				name:       "retry-should-be-exhausted",
+				failures:   3,
+				args:       []string{"--retries", "1", "--retry-backoff", "100ms"},
+				exitStatus: 3,
+				attempts:   2,
+			},
+			{
+				title:      "should not retry on unlisted exit status",
+				name:       "retry-should-not-retry",
+				failures:   3,
+				args:       []string{"--retries", "2", "--retry-backoff", "100ms", "--retry-on-exit-codes", "4,5"},
+				exitStatus: 3,
+				attempts:   1,
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var (
+					tmpd       = t.TempDir()
+					countFile  = filepath.Join(tmpd, "count")
+					script     = filepath.Join(tmpd, "script.sh")
+					scriptData = fmt.Sprintf(`#!/bin/sh
+echo x >> %[1]s
+if [ "$(wc -l < %[1]s)" -le %[2]d ] ; then
+  exit 3
+fi`, countFile, tc.failures)
+				)
+				if !assert.Nil(t, os.WriteFile(script, []byte(scriptData), 0750)) {
+					return
+				}
+				args := append([]string{"-l", tc.name}, tc.args...)
+				args = append(args, "--", "sh", script)
+				r := newKlock(args...).run()
+				assert.Equal(t, tc.exitStatus, r.exitStatus)
+				b, err := os.ReadFile(countFile)
+				if !assert.Nil(t, err) {
+					return
+				}
+				assert.Equal(t, tc.attempts, strings.Count(string(b), "x"))
+			})
+		}
+	})
+
+	t.Run("hook", func(t *testing.T) {
+		for _, tc := range []struct {
+			title      string
+			name       string
+			exit       int
+			exitStatus int
+			want       string
+		}{
+			{
+				title:      "should run pre and post hooks",
+				name:       "hook-should-run",
+				exit:       0,
+				exitStatus: 0,
+				want:       "pre\nmain\npost 0\n",
+			},
+			{
+				title:      "should run post hooks even if the command fails",
+				name:       "hook-should-run-on-failure",
+				exit:       3,
+				exitStatus: 3,
+				want:       "pre\nmain\nfailure 3\npost 3\n",
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				script := filepath.Join(t.TempDir(), "script.sh")
+				if !assert.Nil(t, os.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\necho main\nexit %d", tc.exit)), 0750)) {
+					return
+				}
+				r := newKlock("-l", tc.name,
+					"--pre-hook", "echo pre",
+					"--post-hook", "echo post $KLOCK_EXIT_CODE",
+					"--on-failure-hook", "echo failure $KLOCK_EXIT_CODE",
+					"--", "sh", script).run()
+				assert.Equal(t, tc.exitStatus, r.exitStatus)
+				assert.Equal(t, tc.want, r.stdout)
+			})
+		}
+		t.Run("should not run the command if pre hook fails", func(t *testing.T) {
+			r := newKlock("-l", "hook-should-not-run", "--pre-hook", "exit 2", "--post-hook", "echo post $KLOCK_EXIT_CODE", "--", "echo", "main").run()
+			assert.Equal(t, 1, r.exitStatus)
+			assert.Equal(t, "post -1\n", r.stdout)
+		})
+		t.Run("should time out", func(t *testing.T) {
+			r := newKlock("-l", "hook-should-time-out", "--pre-hook", "sleep 10", "--pre-hook-timeout", "500ms", "--", "echo", "main").run()
+			assert.Equal(t, 1, r.exitStatus)
+			assert.Empty(t, r.stdout)
+		})
+	})
+
+	t.Run("heartbeat", func(t *testing.T) {
+		for _, tc := range []struct {
+			title      string
+			name       string
+			mode       string
+			beat       string
+			beats      int
+			exitStatus int
+		}{
+			{
+				title:      "should run with file heartbeats",
+				name:       "heartbeat-file-run",
+				mode:       "file",
+				beat:       `touch "$KLOCK_HEARTBEAT_FILE"`,
+				beats:      5,
+				exitStatus: 0,
+			},
+			{
+				title:      "should stop the command missing file heartbeats",
+				name:       "heartbeat-file-timeout",
+				mode:       "file",
+				beat:       `touch "$KLOCK_HEARTBEAT_FILE"`,
+				beats:      0,
+				exitStatus: 124,
+			},
+			{
+				title:      "should run with fd heartbeats",
+				name:       "heartbeat-fd-run",
+				mode:       "fd",
+				beat:       `echo >&"$KLOCK_HEARTBEAT_FD"`,
+				beats:      5,
+				exitStatus: 0,
+			},
+			{
+				title:      "should stop the command missing fd heartbeats",
+				name:       "heartbeat-fd-timeout",
+				mode:       "fd",
+				beat:       `echo >&"$KLOCK_HEARTBEAT_FD"`,
+				beats:      2,
+				exitStatus: 124,
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var (
+					script     = filepath.Join(t.TempDir(), "script.sh")
+					scriptData = fmt.Sprintf(`#!/bin/bash
+for _ in $(seq %[1]d) ; do
+  %[2]s
+  sleep 0.2
+done
+if [ %[1]d -lt 5 ] ; then
+  sleep 30
+fi`, tc.beats, tc.beat)
+				)
+				if !assert.Nil(t, os.WriteFile(script, []byte(scriptData), 0750)) {
+					return
+				}
+				k := newKlock("-l", tc.name, "--heartbeat-timeout", "1s", "--heartbeat-mode", tc.mode, "--", "bash", script)
+				k.cancelDelay = 20 * time.Second
+				r := k.run()
+				assert.Equal(t, tc.exitStatus, r.exitStatus)
+			})
+		}
+
+		t.Run("should not campaign again for the command missing heartbeats", func(t *testing.T) {
+			k := newKlock("-l", "heartbeat-campaign", "--campaign", "--campaign-backoff", "100ms",
+				"--heartbeat-timeout", "1s", "--heartbeat-exit-code", "5", "--", "sleep", "30")
+			k.cancelDelay = 20 * time.Second
+			r := k.run()
+			assert.Equal(t, 5, r.exitStatus)
+			assert.NotContains(t, r.stderr, "term=2")
+		})
+	})
+
+	t.Run("output", func(t *testing.T) {
+		t.Run("should add prefix", func(t *testing.T) {
+			const name = "output-should-add-prefix"
+			r := newKlock("-l", name, "-i", name+"-id", "--output-prefix", "[{{.Name}} {{.Identity}} {{.Stream}}] ", "--", "echo", "ok").run()
+			r.assertSuccess(t)
+			assert.Equal(t, fmt.Sprintf("[%[1]s %[1]s-id stdout] ok\n", name), r.stdout)
+		})
+		t.Run("should tee", func(t *testing.T) {
+			var (
+				tmpd = t.TempDir()
+				out  = filepath.Join(tmpd, "out")
+			)
+			r := newKlock("-l", "output-should-tee", "--tee-stdout", out, "--", "echo", "ok").run()
+			r.assertSuccess(t)
+			assert.Equal(t, "ok\n", r.stdout)
+			b, err := os.ReadFile(out)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, "ok\n", string(b))
+		})
+		t.Run("should log", func(t *testing.T) {
+			r := newKlock("-l", "output-should-log", "--output-log", "--", "echo", "ok").run()
+			r.assertSuccess(t)
+			assert.Empty(t, r.stdout)
+			assert.Contains(t, r.stderr, `name="output-should-log" id="klock" stream="stdout" line="ok"`)
+		})
+	})
+
+	t.Run("save output", func(t *testing.T) {
+		const name = "save-output"
+		defer func() {
+			_ = newKubectl("delete", "configmap", name, "--ignore-not-found=true").run()
+		}()
+		script := filepath.Join(t.TempDir(), "script.sh")
+		if !assert.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\necho line1\necho line2 >&2\necho line3\nexit 2"), 0750)) {
+			return
+		}
+		r := newKlock("-l", name, "--save-output-configmap", name, "--save-output-lines", "2", "--", "sh", script).run()
+		assert.Equal(t, 2, r.exitStatus)
+
+		r = newKubectl("get", "configmap", name, "-o=jsonpath={.data}").run()
+		r.assertSuccess(t)
+		got := map[string]string{}
+		if !assert.Nil(t, json.Unmarshal([]byte(r.stdout), &got)) {
+			return
+		}
+		assert.Equal(t, "2", got["exit-code"])
+		assert.Equal(t, "1", got["attempts"])
+		assert.Equal(t, name, got["lease"])
+		assert.Len(t, strings.Split(got["output"], "\n"), 2)
+		assert.Contains(t, got["output"], "line3")
+
+		r = newKubectl("get", "configmap", name, "-o=jsonpath={.metadata.labels}").run()
+		r.assertSuccess(t)
+		assert.Contains(t, r.stdout, `"app.kubernetes.io/managed-by":"k8s-lease-klock"`)
+	})
+
+	t.Run("status", func(t *testing.T) {
+		const name = "status"
+		script := filepath.Join(t.TempDir(), "script.sh")
+		if !assert.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\nexit 3"), 0750)) {
+			return
+		}
+		r := newKlock("-l", name, "-i", name+"-id", "--record-last-run", "--", "sh", script).run()
+		assert.Equal(t, 3, r.exitStatus)
+
+		// the subcommand must be the first argument
+		r = newRunner(klock, "status", "-l", name).run()
+		r.assertSuccess(t)
+		assert.Contains(t, r.stdout, "name: "+name+"\n")
+		assert.Contains(t, r.stdout, "last exit code: 3\n")
+		assert.Contains(t, r.stdout, "last holder: "+name+"-id\n")
+	})
+
+	t.Run("kubeconfig context", func(t *testing.T) {
+		r := newRunner(klock, "status", "-l", "status", "--context", "no-such-context").run()
+		assert.Equal(t, 1, r.exitStatus)
+		assert.Contains(t, r.stderr, "no-such-context")
+	})
+
+	t.Run("in cluster", func(t *testing.T) {
+		r := newRunner(klock, "status", "-l", "status").run()
+		r.assertSuccess(t)
+		assert.Contains(t, r.stderr, `source="kubeconfig"`)
+
+		r = newRunner(klock, "status", "-l", "status", "--in-cluster", "true").run()
+		assert.Equal(t, 1, r.exitStatus)
+		assert.Contains(t, r.stderr, "not running in the cluster")
+	})
+
+	t.Run("api client", func(t *testing.T) {
+		r := newRunner(klock, "status", "-l", "status", "--kube-api-qps", "50", "--kube-api-burst", "100", "--request-timeout", "5s").run()
+		r.assertSuccess(t)
+		assert.Contains(t, r.stdout, "name: status\n")
+	})
+
+	t.Run("min interval", func(t *testing.T) {
+		const name = "min-interval"
+		r := newKlock("-l", name, "--min-interval", "1h", "--skipped-exit-code", "3", "--", "echo", "ok").run()
+		r.assertSuccess(t)
+		assert.Equal(t, "ok\n", r.stdout)
+
+		r = newKlock("-l", name, "--min-interval", "1h", "--skipped-exit-code", "3", "--", "echo", "ok").run()
+		assert.Equal(t, 3, r.exitStatus)
+		assert.Empty(t, r.stdout)
+
+		r = newKlock("-l", name, "--min-interval", "1h", "--", "echo", "ok").run()
+		r.assertSuccess(t)
+		assert.Empty(t, r.stdout)
+	})
+
+	t.Run("once", func(t *testing.T) {
+		const name = "once"
+		r := newKlock("-l", name, "-u", "--once-key", "v1", "--skipped-exit-code", "3", "--", "echo", "ok").run()
+		r.assertSuccess(t)
+		assert.Equal(t, "ok\n", r.stdout)
+
+		r = newKlock("-l", name, "-u", "--once-key", "v1", "--skipped-exit-code", "3", "--", "echo", "ok").run()
+		assert.Equal(t, 3, r.exitStatus)
+		assert.Empty(t, r.stdout)
+
+		r = newKlock("-l", name, "-u", "--once-key", "v1", "--force", "--", "echo", "ok").run()
+		r.assertSuccess(t)
+		assert.Equal(t, "ok\n", r.stdout)
+
+		r = newKubectl("get", "lease", name+"-once").run()
+		r.assertSuccess(t)
+	})
+
+	t.Run("default identity", func(t *testing.T) {
+		r := newKlock("-l", "default-identity", "--", "true").run()
+		r.assertSuccess(t)
+		assert.Contains(t, r.stderr, "the default identity is used")
+
+		r = newKlock("-l", "default-identity", "-g", "--", "true").run()
+		r.assertSuccess(t)
+		assert.NotContains(t, r.stderr, "the default identity is used")
+	})
+
+	t.Run("identity template", func(t *testing.T) {
+		const name = "identity-template"
+		t.Setenv("POD_NAME", "some-pod")
+		r := newKlock("-l", name, "--identity-template", "tmpl-{{.PodName}}", "--record-last-run", "--", "true").run()
+		r.assertSuccess(t)
+		assert.NotContains(t, r.stderr, "the default identity is used")
+
+		r = newKubectl("get", "lease", name, `-o=jsonpath={.metadata.annotations.k8s-lease\.berquerant\.github\.com/last-holder}`).run()
+		r.assertSuccess(t)
+		assert.Equal(t, "tmpl-some-pod", r.stdout)
+
+		r = newKlock("-l", name, "--identity-template", "{{.Unknown}}", "--", "true").run()
+		assert.Equal(t, 1, r.exitStatus)
+	})
+
+	t.Run("reentrant", func(t *testing.T) {
+		const name = "reentrant"
+		var (
+			dir    = t.TempDir()
+			script = filepath.Join(dir, "script.sh")
+		)
+		bin, err := filepath.Abs(klock)
+		if !assert.Nil(t, err) {
+			return
+		}
+		if !assert.Nil(t, os.WriteFile(script, []byte(bin+` -l `+name+` -i `+name+` --reentrant -w 5s -- echo inner`), 0750)) {
+			return
+		}
+		r := newKlock("-l", name, "-i", name, "--reentrant", "--", "sh", script).run()
+		r.assertSuccess(t)
+		assert.Equal(t, "inner\n", r.stdout)
+	})
+
+	t.Run("shard", func(t *testing.T) {
+		const name = "shard"
+		r := newKlock("-l", name, "--shard-key", "tenant-a", "--shards", "1", "--", "echo", "ok").run()
+		r.assertSuccess(t)
+		assert.Equal(t, "ok\n", r.stdout)
+
+		r = newKubectl("get", "lease", name+"-shard-0", `-o=jsonpath={.metadata.annotations.k8s-lease\.berquerant\.github\.com/shard-key}`).run()
+		r.assertSuccess(t)
+		assert.Equal(t, "tenant-a", r.stdout)
+	})
+
+	t.Run("barrier", func(t *testing.T) {
+		const (
+			name    = "barrier"
+			parties = 2
+		)
+		var (
+			wg      sync.WaitGroup
+			results = make([]*result, parties)
+		)
+		for i := range parties {
+			wg.Go(func() {
+				time.Sleep(time.Duration(i) * time.Second)
+				results[i] = newRunner(klock, "barrier", "--name", name, "--parties", strconv.Itoa(parties), "-g",
+					"--cleanup-lease", "--retry-period", "200ms", "--timeout", "1m").run()
+			})
+		}
+		wg.Wait()
+		for _, r := range results {
+			r.assertSuccess(t)
+		}
+	})
+
+	t.Run("barrier timeout", func(t *testing.T) {
+		r := newRunner(klock, "barrier", "--name", "barrier-timeout", "--parties", "2", "-g",
+			"--cleanup-lease", "--timeout", "1s", "--timeout-exit-code", "5").run()
+		assert.Equal(t, 5, r.exitStatus)
+	})
+
+	t.Run("ratelimit", func(t *testing.T) {
+		const name = "ratelimit"
+		args := []string{"ratelimit", "--name", name, "--rate", "1/h", "--burst", "1", "--no-wait", "--rejected-exit-code", "5", "--", "echo", "ok"}
+		r := newRunner(klock, args...).run()
+		r.assertSuccess(t)
+		assert.Equal(t, "ok\n", r.stdout)
+
+		r = newRunner(klock, args...).run()
+		assert.Equal(t, 5, r.exitStatus)
+		assert.Empty(t, r.stdout)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		var (
+			dir     = t.TempDir()
+			counter = filepath.Join(dir, "counter")
+			script  = filepath.Join(dir, "script.sh")
+		)
+		if !assert.Nil(t, os.WriteFile(script, []byte(`#!/bin/sh
+echo x >> `+counter+`
+[ "$(wc -l < `+counter+`)" -ge 3 ]`), 0750)) {
+			return
+		}
+		r := newKlock("-l", "restart", "--restart", "on-failure", "--restart-backoff", "100ms", "--", "sh", script).run()
+		r.assertSuccess(t)
+		b, err := os.ReadFile(counter)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, "x\nx\nx\n", string(b))
+
+		r = newKlock("-l", "restart-crash-loop", "--restart", "always", "--restart-backoff", "10ms", "--crash-loop-threshold", "2", "--", "false").run()
+		assert.Equal(t, 1, r.exitStatus)
+		assert.Contains(t, r.stderr, "CrashLoop")
+	})
+
+	t.Run("campaign", func(t *testing.T) {
+		var (
+			dir     = t.TempDir()
+			counter = filepath.Join(dir, "counter")
+			script  = filepath.Join(dir, "script.sh")
+		)
+		if !assert.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\necho x >> "+counter), 0750)) {
+			return
+		}
+		k := newKlock("-l", "campaign", "--campaign", "--campaign-backoff", "100ms", "--", "sh", script)
+		k.cancelDelay = 3 * time.Second
+		r := k.run()
+		assert.Zero(t, r.exitStatus)
+		assert.Contains(t, r.stderr, "term=2")
+		b, err := os.ReadFile(counter)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Greater(t, len(strings.Split(strings.TrimSpace(string(b)), "\n")), 1)
+	})
+
+	t.Run("cron", func(t *testing.T) {
+		r := newRunner(klock, "cron", "--schedule", "* * *", "--", "echo", "ok").run()
+		assert.Equal(t, 1, r.exitStatus)
+		assert.Contains(t, r.stderr, "InvalidSchedule")
+	})
+
+	t.Run("xargs", func(t *testing.T) {
+		var (
+			dir    = t.TempDir()
+			script = filepath.Join(dir, "script.sh")
+		)
+		if !assert.Nil(t, os.WriteFile(script, []byte(`#!/bin/sh
+touch `+dir+`/"$1"
+[ "$1" != "fail" ]`), 0750)) {
+			return
+		}
+
+		t.Run("should run each item", func(t *testing.T) {
+			k := newRunner(klock, "xargs", "--lease-template", "xargs-{}", "-P", "2", "-g", "--", "sh", script, "{}")
+			k.stdin = "a\nb\n\nc\n"
+			r := k.run()
+			r.assertSuccess(t)
+			for _, x := range []string{"a", "b", "c"} {
+				_, err := os.Stat(filepath.Join(dir, x))
+				assert.Nil(t, err, x)
+			}
+		})
+
+		t.Run("should aggregate failures", func(t *testing.T) {
+			k := newRunner(klock, "xargs", "--lease-template", "xargs-{}", "-g", "--", "sh", script, "{}")
+			k.stdin = "d\nfail\n"
+			r := k.run()
+			assert.Equal(t, 123, r.exitStatus)
+			_, err := os.Stat(filepath.Join(dir, "d"))
+			assert.Nil(t, err)
+		})
+
+		t.Run("should fail invalid lease names", func(t *testing.T) {
+			k := newRunner(klock, "xargs", "--lease-template", "xargs-{}", "--wait", "0", "-g", "--", "sh", script, "{}")
+			k.stdin = "Tenant_A\nf\n"
+			r := k.run()
+			assert.Equal(t, 123, r.exitStatus)
+			assert.Contains(t, r.stderr, "InvalidLeaseName")
+			_, err := os.Stat(filepath.Join(dir, "Tenant_A"))
+			assert.True(t, os.IsNotExist(err))
+			_, err = os.Stat(filepath.Join(dir, "f"))
+			assert.Nil(t, err)
+		})
+
+		t.Run("should run duplicated items once", func(t *testing.T) {
+			k := newRunner(klock, "xargs", "--lease-template", "xargs-{}", "-P", "2", "-g", "--", "sh", script, "{}")
+			k.stdin = "g\ng\n"
+			k.run().assertSuccess(t)
+		})
+
+		t.Run("should skip held items", func(t *testing.T) {
+			var (
+				wg     sync.WaitGroup
+				holder *result
+			)
+			wg.Go(func() {
+				holder = newKlock("-l", "xargs-held", "-g", "--", "sleep", "5").run()
+			})
+			time.Sleep(2 * time.Second)
+			k := newRunner(klock, "xargs", "--lease-template", "xargs-{}", "--on-held", "skip", "-g", "--", "sh", script, "{}")
+			k.stdin = "held\ne\n"
+			r := k.run()
+			wg.Wait()
+			holder.assertSuccess(t)
+			r.assertSuccess(t)
+			_, err := os.Stat(filepath.Join(dir, "held"))
+			assert.True(t, os.IsNotExist(err))
+			_, err = os.Stat(filepath.Join(dir, "e"))
+			assert.Nil(t, err)
+		})
+	})
+
+	t.Run("work", func(t *testing.T) {
+		var (
+			dir       = t.TempDir()
+			itemsFile = filepath.Join(dir, "items")
+			logFile   = filepath.Join(dir, "log")
+			script    = filepath.Join(dir, "script.sh")
+			wg        sync.WaitGroup
+			results   = make([]*result, 2)
+		)
+		if !assert.Nil(t, os.WriteFile(itemsFile, []byte("a\nb\nc\nd\n"), 0600)) {
+			return
+		}
+		if !assert.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\necho \"$1\" >> "+logFile+"\nsleep 0.5"), 0750)) {
+			return
+		}
+		for i := range results {
+			wg.Go(func() {
+				results[i] = newRunner(klock, "work", "--name", "work", "--items-file", itemsFile, "-g", "--retry-period", "500ms", "--", "sh", script, "{}").run()
+			})
+		}
+		wg.Wait()
+		for _, r := range results {
+			r.assertSuccess(t)
+		}
+		b, err := os.ReadFile(logFile)
+		if !assert.Nil(t, err) {
+			return
+		}
+		got := strings.Split(strings.TrimSpace(string(b)), "\n")
+		slices.Sort(got)
+		assert.Equal(t, []string{"a", "b", "c", "d"}, got)
+
+		t.Run("should fail items", func(t *testing.T) {
+			var (
+				failItemsFile = filepath.Join(dir, "fail-items")
+				failScript    = filepath.Join(dir, "fail.sh")
+			)
+			if !assert.Nil(t, os.WriteFile(failItemsFile, []byte("ok\nfail\n"), 0600)) {
+				return
+			}
+			if !assert.Nil(t, os.WriteFile(failScript, []byte(`#!/bin/sh
+[ "$1" != "fail" ]`), 0750)) {
+				return
+			}
+			r := newRunner(klock, "work", "--name", "work-fail", "--items-file", failItemsFile, "-g", "--retry-period", "500ms", "--", "sh", failScript, "{}").run()
+			assert.Equal(t, 123, r.exitStatus)
+			assert.Contains(t, r.stderr, "WorkFailed")
+		})
+	})
 }
@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"os"
 	"path/filepath"
 	"strconv"
 	"testing"
@@ -89,7 +90,7 @@ func TestSignal(t *testing.T) {
 				cancelSignal:  "INT",
 				killAfter:     "2s",
 				want:          "SIGINT\n",
-				exit:          255,
+				exit:          137,
 			},
 			{
 				title:         "should not SIGKILL",
@@ -129,4 +130,23 @@ func TestSignal(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("report", func(t *testing.T) {
+		t.Run("should report the signal not sent by klock", func(t *testing.T) {
+			script := filepath.Join(t.TempDir(), "script.sh")
+			if !assert.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\nkill -TERM $$"), 0750)) {
+				return
+			}
+			r := newKlock("-l", "signal-report-not-sent", "--report", "--", "sh", script).run()
+			assert.Equal(t, 143, r.exitStatus)
+			assert.Contains(t, r.stderr, "signal: SIGTERM (not sent by klock)")
+		})
+		t.Run("should report the signal sent by klock", func(t *testing.T) {
+			k := newKlock("-l", "signal-report-sent", "--report", "-s", "INT", "--kill-after", "1s", "--", bin, "-wait-signal", "-delay", "10s")
+			k.cancelDelay = time.Second
+			r := k.run()
+			assert.Equal(t, 137, r.exitStatus)
+			assert.Contains(t, r.stderr, "signal: SIGKILL (sent by klock)")
+		})
+	})
 }